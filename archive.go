@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/storage/v1"
+)
+
+// gcsArchiveSink writes every published message as its own gzipped object in GCS_ARCHIVE_BUCKET, partitioned
+// by date and named by the URL hash and collection time
+type gcsArchiveSink struct {
+	service *storage.Service
+	bucket  string
+}
+
+// newGCSArchiveSink returns a sink archiving to the bucket through the shared Cloud Storage service
+func newGCSArchiveSink(ctx context.Context, bucket string) (*gcsArchiveSink, error) {
+	service, err := storageService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsArchiveSink{service: service, bucket: bucket}, nil
+}
+
+// name implements sink
+func (g *gcsArchiveSink) name() string {
+	return "gs://" + g.bucket
+}
+
+// send implements sink, uploading the object before returning
+func (g *gcsArchiveSink) send(ctx context.Context, output *OutputPayload, data []byte, attributes map[string]string, done func(string, error)) {
+	done(g.deliver(ctx, output, data, attributes))
+}
+
+// deliver uploads the gzipped message, returning the URI of the written object
+func (g *gcsArchiveSink) deliver(ctx context.Context, output *OutputPayload, data []byte, attributes map[string]string) (string, error) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	hash := sha256.Sum256([]byte(output.URL))
+	extension, contentType := ".json.gz", "application/json"
+	if config.OutputFormat == outputFormatWARC {
+		extension, contentType = ".warc.gz", "application/warc"
+	}
+	name := fmt.Sprintf("%s/%s-%s%s", now.Format("2006/01/02"), hex.EncodeToString(hash[:]), now.Format("20060102T150405.000000000Z"), extension)
+
+	object := &storage.Object{Name: name, ContentType: contentType, ContentEncoding: "gzip"}
+	if _, err := g.service.Objects.Insert(g.bucket, object).Media(&compressed).Context(ctx).Do(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("gs://%s/%s", g.bucket, name), nil
+}
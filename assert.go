@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// AssertionResult records whether a response header held its expected value
+type AssertionResult struct {
+	Header   string `json:"header"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Passed   bool   `json:"passed"`
+}
+
+// assertHeaders compares each expected header against the response, in header name order; a missing header
+// fails its assertion
+func assertHeaders(expected map[string]string, header http.Header) []AssertionResult {
+	var results []AssertionResult
+	for _, name := range slices.Sorted(maps.Keys(expected)) {
+		values := header.Values(name)
+		actual := strings.Join(values, ", ")
+		results = append(results, AssertionResult{
+			Header:   name,
+			Expected: expected[name],
+			Actual:   actual,
+			Passed:   len(values) > 0 && actual == expected[name],
+		})
+	}
+	return results
+}
+
+// BodyAssertionResult records whether the response body contained an expected substring; Unevaluated marks an
+// assertion that could not be checked because the body was not kept in memory
+type BodyAssertionResult struct {
+	Substring   string `json:"substring"`
+	Passed      bool   `json:"passed"`
+	Unevaluated bool   `json:"unevaluated,omitzero"`
+}
+
+// assertBodyContains checks the body for each expected substring, optionally ignoring case
+func assertBodyContains(substrings []string, body []byte, ignoreCase bool) []BodyAssertionResult {
+	if ignoreCase {
+		body = bytes.ToLower(body)
+	}
+
+	var results []BodyAssertionResult
+	for _, substring := range substrings {
+		var passed bool
+		if ignoreCase {
+			passed = bytes.Contains(body, []byte(strings.ToLower(substring)))
+		} else {
+			passed = bytes.Contains(body, []byte(substring))
+		}
+		results = append(results, BodyAssertionResult{Substring: substring, Passed: passed})
+	}
+	return results
+}
+
+// unevaluatedBodyAssertions reports each expected substring as failed and unevaluated, for bodies that were not
+// captured or were streamed to GCS, so a consumer never mistakes a missing check for a pass
+func unevaluatedBodyAssertions(substrings []string) []BodyAssertionResult {
+	var results []BodyAssertionResult
+	for _, substring := range substrings {
+		results = append(results, BodyAssertionResult{Substring: substring, Unevaluated: true})
+	}
+	return results
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
+)
+
+// Modes for signing outbound requests
+const (
+	requestAuthNone     = "none"
+	requestAuthGCPOIDC  = "gcp_oidc"
+	requestAuthAWSSigV4 = "aws_sigv4"
+)
+
+// signRequest adds the credentials selected by REQUEST_AUTH_MODE to the outbound request when its host is listed
+// in REQUEST_AUTH_HOSTS, so URLs supplied by producers cannot collect the service's credentials
+func signRequest(ctx context.Context, req *http.Request) error {
+	if !slices.Contains(config.RequestAuthHosts, strings.ToLower(req.URL.Hostname())) {
+		return nil
+	}
+
+	switch config.RequestAuthMode {
+	case requestAuthGCPOIDC:
+		return signGCPOIDC(ctx, req)
+	case requestAuthAWSSigV4:
+		return signAWSSigV4(req, time.Now())
+	default:
+		return nil
+	}
+}
+
+// resignRedirect replaces the credentials a redirect copied from the previous request, which were signed for
+// its URL, with credentials for the redirect target, or none when the target is not in REQUEST_AUTH_HOSTS
+func resignRedirect(req *http.Request) error {
+	if config.RequestAuthMode == requestAuthNone {
+		return nil
+	}
+
+	req.Header.Del("Authorization")
+	for key := range req.Header {
+		if strings.HasPrefix(strings.ToLower(key), "x-amz-") {
+			req.Header.Del(key)
+		}
+	}
+	return signRequest(req.Context(), req)
+}
+
+// idTokenSources caches a token source per audience so ID tokens are reused until they expire
+var (
+	idTokenSourcesMu sync.Mutex
+	idTokenSources   = make(map[string]oauth2.TokenSource)
+)
+
+// signGCPOIDC attaches a Google-signed ID token for the configured audience, defaulting to the origin of the
+// request URL as Cloud Run and IAP expect
+func signGCPOIDC(ctx context.Context, req *http.Request) error {
+	audience := cmp.Or(config.RequestAuthAudience, req.URL.Scheme+"://"+req.URL.Host)
+
+	idTokenSourcesMu.Lock()
+	source, ok := idTokenSources[audience]
+	if !ok {
+		var err error
+		source, err = idtoken.NewTokenSource(context.WithoutCancel(ctx), audience)
+		if err != nil {
+			idTokenSourcesMu.Unlock()
+			return fmt.Errorf("creating ID token source for %s: %w", audience, err)
+		}
+		idTokenSources[audience] = source
+	}
+	idTokenSourcesMu.Unlock()
+
+	token, err := source.Token()
+	if err != nil {
+		return fmt.Errorf("fetching ID token for %s: %w", audience, err)
+	}
+	token.SetAuthHeader(req)
+	return nil
+}
+
+// signAWSSigV4 signs the request with AWS Signature Version 4 using the configured credentials, region, and
+// service
+func signAWSSigV4(req *http.Request, now time.Time) error {
+	payload, err := requestPayload(req)
+	if err != nil {
+		return err
+	}
+	payloadHash := hashBody(payload)
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if config.AWSSessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", config.AWSSessionToken)
+	}
+
+	// Canonical headers are the host plus every x-amz-* header, sorted by lowercase name
+	headers := map[string]string{"host": cmp.Or(req.Host, req.URL.Host)}
+	for key, values := range req.Header {
+		if name := strings.ToLower(key); strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := slices.Sorted(maps.Keys(headers))
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		cmp.Or(req.URL.EscapedPath(), "/"),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, config.AWSRegion, config.AWSService, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hashBody([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+config.AWSSecretAccessKey), date)
+	for _, part := range []string{config.AWSRegion, config.AWSService, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AWSAccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// requestPayload returns a copy of the request body without consuming it
+func requestPayload(req *http.Request) ([]byte, error) {
+	if req.GetBody == nil {
+		return nil, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// canonicalQuery encodes query parameters sorted by name and then value with RFC 3986 escaping as SigV4
+// requires
+func canonicalQuery(query neturl.Values) string {
+	escaped := make(map[string][]string, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			escaped[sigV4Escape(key)] = append(escaped[sigV4Escape(key)], sigV4Escape(value))
+		}
+	}
+
+	var pairs []string
+	for _, key := range slices.Sorted(maps.Keys(escaped)) {
+		for _, value := range slices.Sorted(slices.Values(escaped[key])) {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent-encodes everything except RFC 3986 unreserved characters
+func sigV4Escape(value string) string {
+	return strings.ReplaceAll(neturl.QueryEscape(value), "+", "%20")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data under the key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
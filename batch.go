@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// Modes of BATCH_PARTIAL_FAILURE_MODE, deciding how a batch where only some URLs failed is acknowledged
+const (
+	batchAckAll          = "ack_all"
+	batchNackAll         = "nack_all"
+	batchRepublishFailed = "republish_failed"
+)
+
+// republishAttemptAttribute is the message attribute counting how many times a request was re-published
+const republishAttemptAttribute = "republish-attempt"
+
+// inputTopic is the topic failed batch items and large URL lists are re-published to, or nil unless INPUT_PUBSUB
+// is set
+var inputTopic *pubsub.Topic
+
+// newInputTopic connects to the INPUT_PUBSUB topic, exiting when it cannot be published to since re-published
+// requests would otherwise be lost
+func newInputTopic(ctx context.Context) *pubsub.Topic {
+	client, err := pubsub.NewClient(ctx, config.ProjectID)
+	if err != nil {
+		log.Fatalf("Error creating PubSub client for input topic: %v", err)
+	}
+
+	topic := client.Topic(config.InputTopic)
+	if err := verifyTopic(ctx, topic); err != nil {
+		log.Fatalf("Input topic unavailable: %v", err)
+	}
+	return topic
+}
+
+// republishAttempt returns how many times the message's requests were already re-published, zero for a message
+// from a producer
+func republishAttempt(attributes map[string]string) int {
+	attempt, err := strconv.Atoi(attributes[republishAttemptAttribute])
+	if err != nil || attempt < 0 {
+		return 0
+	}
+	return attempt
+}
+
+// isRetryableOutcome reports whether a request with the outcome may succeed when collected again
+func isRetryableOutcome(outcome handlerOutcome) bool {
+	return outcome == outcomeTransientError || outcome == outcomeInternalError
+}
+
+// batchOutcome combines the outcomes of the requests of a message into the handler outcome; when only some
+// requests of a batch failed, BATCH_PARTIAL_FAILURE_MODE decides whether the message is redelivered. attempt is
+// the number of times the message's requests were already re-published
+func batchOutcome(ctx context.Context, requests []InputPayload, outcomes []handlerOutcome, attempt int) handlerOutcome {
+	outcome := outcomeSuccess
+	var failed []InputPayload
+	for i, requestOutcome := range outcomes {
+		outcome = worseOutcome(outcome, requestOutcome)
+		if isRetryableOutcome(requestOutcome) {
+			failed = append(failed, requests[i])
+		}
+	}
+
+	// Nothing to retry, or nothing that succeeded and would be collected twice by a redelivery
+	if len(failed) == 0 || len(failed) == len(requests) {
+		return outcome
+	}
+
+	switch config.BatchPartialFailureMode {
+	case batchAckAll:
+		log.Printf("Acknowledging batch with %d of %d failed URLs", len(failed), len(requests))
+		return outcomeSuccess
+	case batchRepublishFailed:
+		// Requests that keep failing are redelivered instead, so the subscription's retry and dead-letter
+		// policies decide their fate
+		if attempt >= config.RepublishMaxAttempts {
+			log.Printf("Not re-publishing %d failed URLs after %d attempts, redelivering the batch", len(failed), attempt)
+			return outcome
+		}
+		if err := republishRequests(ctx, failed, attempt+1); err != nil {
+			log.Printf("Error re-publishing %d failed URLs, redelivering the batch: %v", len(failed), err)
+			return outcome
+		}
+		log.Printf("Re-published %d of %d failed URLs to %s", len(failed), len(requests), config.InputTopic)
+		return outcomeSuccess
+	default:
+		return outcome
+	}
+}
+
+// republishRequests publishes the requests to the input topic stamped with the attempt, so the original is only
+// acknowledged once the retry is queued
+func republishRequests(ctx context.Context, requests []InputPayload, attempt int) error {
+	return publishRequests(ctx, requests, map[string]string{republishAttemptAttribute: strconv.Itoa(attempt)})
+}
+
+// publishRequests publishes the requests to the input topic as batch messages with the attributes, waiting until
+// every message is accepted. Each message holds at most MAX_BATCH_SIZE requests, since re-published requests
+// count as inline ones when received again
+func publishRequests(ctx context.Context, requests []InputPayload, attributes map[string]string) error {
+	if inputTopic == nil {
+		return fmt.Errorf("no input topic")
+	}
+
+	size := len(requests)
+	if config.MaxBatchSize > 0 {
+		size = config.MaxBatchSize
+	}
+	var results []*pubsub.PublishResult
+	for chunk := range slices.Chunk(requests, size) {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		results = append(results, inputTopic.Publish(ctx, &pubsub.Message{Data: data, Attributes: attributes}))
+	}
+	for _, result := range results {
+		if _, err := result.Get(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
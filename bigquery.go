@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/api/bigquery/v2"
+)
+
+// bigQuerySink streams a reduced row of response metadata for every output to a BigQuery table
+type bigQuerySink struct {
+	service   *bigquery.Service
+	projectID string
+	datasetID string
+	tableID   string
+}
+
+// newBigQuerySink connects to the BIGQUERY_TABLE, given as project.dataset.table or dataset.table in the
+// GOOGLE_CLOUD_PROJECT
+func newBigQuerySink(ctx context.Context) (*bigQuerySink, error) {
+	projectID, datasetID, tableID, err := parseBigQueryTable(config.BigQueryTable, config.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := bigquery.NewService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &bigQuerySink{service: service, projectID: projectID, datasetID: datasetID, tableID: tableID}, nil
+}
+
+// parseBigQueryTable splits a table reference into its project, dataset and table IDs
+func parseBigQueryTable(table string, defaultProject string) (string, string, string, error) {
+	parts := strings.Split(table, ".")
+	if len(parts) == 2 && defaultProject != "" {
+		parts = append([]string{defaultProject}, parts...)
+	}
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("table %q is not project.dataset.table", table)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// name implements sink
+func (b *bigQuerySink) name() string {
+	return b.projectID + "." + b.datasetID + "." + b.tableID
+}
+
+// send implements sink, inserting the row before returning
+func (b *bigQuerySink) send(ctx context.Context, output *OutputPayload, data []byte, attributes map[string]string, done func(string, error)) {
+	done(b.deliver(ctx, output, data, attributes))
+}
+
+// deliver inserts the analytics row of the output; the encoded message is not used
+func (b *bigQuerySink) deliver(ctx context.Context, output *OutputPayload, data []byte, attributes map[string]string) (string, error) {
+	insertID := uuid.NewString()
+	request := &bigquery.TableDataInsertAllRequest{
+		Rows: []*bigquery.TableDataInsertAllRequestRows{{InsertId: insertID, Json: analyticsRow(output)}},
+	}
+
+	response, err := b.service.Tabledata.InsertAll(b.projectID, b.datasetID, b.tableID, request).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	for _, insertErr := range response.InsertErrors {
+		for _, rowErr := range insertErr.Errors {
+			return "", fmt.Errorf("inserting row: %s", rowErr.Message)
+		}
+	}
+	return insertID, nil
+}
+
+// analyticsRow returns the response metadata recorded in BigQuery, matching the columns of the analytics table
+func analyticsRow(output *OutputPayload) map[string]bigquery.JsonValue {
+	return map[string]bigquery.JsonValue{
+		"url":            output.URL,
+		"host":           output.Host,
+		"statusCode":     output.StatusCode,
+		"responseTimeMs": output.ResponseTime,
+		"bodyBytes":      output.BodyBytes,
+		"requestTime":    output.RequestTime,
+		"outcome":        output.Outcome,
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"syscall"
+	"time"
+)
+
+// maxDrainBytes is how much of an unread body is discarded so its connection can be reused; longer bodies are
+// abandoned by closing the connection instead
+const maxDrainBytes = 64 * 1024
+
+// drainBody discards up to maxDrainBytes of a body that is not captured
+func drainBody(body io.Reader) {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes))
+}
+
+// minThroughputBytes is the smallest body for which a download rate is reported, as smaller bodies arrive in
+// too few packets for the rate to be meaningful
+const minThroughputBytes = 64 * 1024
+
+// throughputKBps returns the body download rate in KiB per second rounded to two decimals, or zero when the
+// body is too small to measure
+func throughputKBps(size int64, elapsed time.Duration) float64 {
+	if size < minThroughputBytes || elapsed <= 0 {
+		return 0
+	}
+	kbps := float64(size) / 1024 / elapsed.Seconds()
+	return math.Round(kbps*100) / 100
+}
+
+// matchingReader records whether a pattern occurred in the bytes read through it, including across reads
+type matchingReader struct {
+	r       io.Reader
+	pattern []byte
+	tail    []byte
+	matched bool
+}
+
+// Read implements io.Reader
+func (m *matchingReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	if n > 0 && !m.matched {
+		window := append(m.tail, p[:n]...)
+		m.matched = bytes.Contains(window, m.pattern)
+		// Keep just enough of the window to find a match straddling the next read
+		m.tail = append(m.tail[:0], window[max(0, len(window)-len(m.pattern)+1):]...)
+	}
+	return n, err
+}
+
+// truncatingReader reads at most limit bytes from the underlying reader and records whether it held more
+type truncatingReader struct {
+	r         io.Reader
+	remaining int64
+	probed    bool
+	truncated bool
+}
+
+// newTruncatingReader returns a reader that stops after limit bytes
+func newTruncatingReader(r io.Reader, limit int64) *truncatingReader {
+	return &truncatingReader{r: r, remaining: limit}
+}
+
+// Read implements io.Reader
+func (t *truncatingReader) Read(p []byte) (int, error) {
+	if t.remaining <= 0 {
+		// Probe for one more byte to tell a body of exactly limit bytes from a truncated one
+		if !t.probed {
+			t.probed = true
+			var probe [1]byte
+			if n, _ := io.ReadFull(t.r, probe[:]); n > 0 {
+				t.truncated = true
+			}
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > t.remaining {
+		p = p[:t.remaining]
+	}
+	n, err := t.r.Read(p)
+	t.remaining -= int64(n)
+	return n, err
+}
+
+// errBodyReadTimeout is the cause a request is cancelled with when BODY_READ_TIMEOUT expires
+var errBodyReadTimeout = errors.New("body read timeout expired")
+
+// errTTFBBudgetExceeded is the cause a request is cancelled with when no response byte arrived within
+// TTFB_BUDGET_MS
+var errTTFBBudgetExceeded = errors.New("time to first byte budget exceeded")
+
+// deadlineReader ends the body where the fetch deadline or client timeout cut it off, or where the server
+// closed or reset the connection before the body was complete, so a slowly trickling or cut off body yields the
+// part received so far instead of failing the whole fetch
+type deadlineReader struct {
+	ctx         context.Context
+	r           io.Reader
+	deadlineHit bool
+	closedEarly bool
+}
+
+// Read implements io.Reader
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	if isDeadlineError(d.ctx, err) {
+		d.deadlineHit = true
+		return n, io.EOF
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		d.closedEarly = true
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// isDeadlineError reports whether a read failed because the context ended or the client timeout expired
+func isDeadlineError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// bodyTemplate is the request body template compiled from BODY_TEMPLATE, or nil when none is configured
+var bodyTemplate *template.Template
+
+// loadBodyTemplate compiles the request body template
+func loadBodyTemplate(src string) (*template.Template, error) {
+	return template.New("BODY_TEMPLATE").Option("missingkey=error").Parse(src)
+}
+
+// templatedBody returns the request body, rendering the body template for a request that carries no body of its
+// own unless its method does not send one
+func templatedBody(input InputPayload) (string, error) {
+	if bodyTemplate == nil || input.Body != "" {
+		return input.Body, nil
+	}
+	if method := input.method(); method == http.MethodGet || method == http.MethodHead {
+		return "", nil
+	}
+
+	var body strings.Builder
+	if err := bodyTemplate.Execute(&body, input); err != nil {
+		return "", err
+	}
+	return body.String(), nil
+}
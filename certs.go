@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// CertInfo describes one certificate presented by the server during the TLS handshake
+type CertInfo struct {
+	Subject   string `json:"subject"`
+	Issuer    string `json:"issuer"`
+	NotBefore string `json:"notBefore"`
+	NotAfter  string `json:"notAfter"`
+	IsCA      bool   `json:"isCA"`
+}
+
+// certChain describes the certificates in the order the server presented them, leaf first
+func certChain(certs []*x509.Certificate) []CertInfo {
+	var chain []CertInfo
+	for _, cert := range certs {
+		chain = append(chain, CertInfo{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			NotBefore: cert.NotBefore.UTC().Format(time.RFC3339),
+			NotAfter:  cert.NotAfter.UTC().Format(time.RFC3339),
+			IsCA:      cert.IsCA,
+		})
+	}
+	return chain
+}
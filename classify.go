@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"slices"
+	"strings"
+)
+
+// Values of the BodyClassification field explaining how a body was stored
+const (
+	classifiedJSONByContentType = "json_by_content_type"
+	classifiedJSONByContent     = "json_by_content"
+	classifiedTextByContentType = "text_by_content_type"
+	classifiedTextByContent     = "text_by_content"
+	classifiedInvalidJSON       = "invalid_json"
+	classifiedXMLByContentType  = "xml_by_content_type"
+	classifiedXMLByContent      = "xml_by_content"
+	classifiedInvalidXML        = "invalid_xml"
+)
+
+// genericContentTypes say nothing about the body's format, so the body itself is inspected instead
+var genericContentTypes = []string{
+	"",
+	"application/octet-stream",
+	"binary/octet-stream",
+	"text/plain",
+}
+
+// classifyBody decides whether a body is stored as JSON, trusting the declared content type first and only
+// falling back to checking the body when the content type is absent or generic; XML is treated the same way
+func classifyBody(contentType string, body []byte) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	switch {
+	case isJSONMediaType(mediaType):
+		if json.Valid(body) {
+			return classifiedJSONByContentType
+		}
+		return classifiedInvalidJSON
+	case isXMLMediaType(mediaType):
+		if isWellFormedXML(body) {
+			return classifiedXMLByContentType
+		}
+		return classifiedInvalidXML
+	case slices.Contains(genericContentTypes, mediaType):
+		if json.Valid(body) {
+			return classifiedJSONByContent
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(body), []byte("<")) && isWellFormedXML(body) {
+			return classifiedXMLByContent
+		}
+		return classifiedTextByContent
+	default:
+		return classifiedTextByContentType
+	}
+}
+
+// isJSONMediaType reports whether the media type declares JSON, including structured syntax suffixes like +json
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// isXMLMediaType reports whether the media type declares XML, including structured syntax suffixes like +xml
+func isXMLMediaType(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// isWellFormedXML reports whether the body is a well-formed XML document with at least one element, streaming
+// through its tokens rather than unmarshalling it
+func isWellFormedXML(body []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	sawElement := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return sawElement
+		}
+		if err != nil {
+			return false
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			sawElement = true
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// collectAndPublish collects a single URL and publishes the result, returning the output and the handler outcome
+func collectAndPublish(ctx context.Context, input InputPayload, batch *BatchInfo) (*OutputPayload, handlerOutcome) {
+	output, outcome := collectURL(ctx, input)
+	output.BatchInfo = batch
+	if input.groupID != "" {
+		output.GroupID = input.groupID
+		output.Method = input.method()
+	}
+	if outcome == outcomeSuccess {
+		// Flag transitions such as 2xx to 5xx against the previous observation of the URL and method
+		recordStatusChange(output, input.method())
+	}
+	recentOutputs.add(output)
+	stats.record(output)
+	if outcome != outcomeSuccess {
+		publishMessage(output)
+		return output, outcome
+	}
+
+	// Skip publishing bodies identical to the last one seen for the URL when deduplication suppresses them
+	if markUnchanged(output) && config.DedupByHash == dedupSuppress {
+		log.Printf("Response of %s unchanged, not publishing", output.URL)
+		return output, outcomeSuccess
+	}
+
+	// Convert OutputPayload to JSON
+	outputJSON, err := json.Marshal(output)
+	if err != nil {
+		log.Printf("Error marshalling output JSON: %v", err)
+		errorPayload := newErrorPayload("Error marshalling output JSON", input.URL, resultInternalError)
+		errorPayload.BatchInfo = batch
+		publishMessage(errorPayload)
+		return errorPayload, outcomeInternalError
+	}
+
+	// Log the output JSON to the console
+	log.Printf("Processed Response: %s", string(outputJSON))
+
+	publishMessage(output)
+	return output, outcomeSuccess
+}
+
+// collectURL validates and fetches a single URL, returning the payload to publish and the handler outcome
+func collectURL(ctx context.Context, input InputPayload) (*OutputPayload, handlerOutcome) {
+	// Validate URL
+	if !isValidURL(input.URL) {
+		log.Printf("Invalid URL: %s", input.URL)
+		return newErrorPayload("Invalid URL", input.URL, resultInvalidInput), outcomeInvalidInput
+	}
+
+	// Validate destination port
+	if !isAllowedPort(input.URL) {
+		log.Printf("Port not allowed: %s", input.URL)
+		return newErrorPayload("Port not allowed", input.URL, resultInvalidInput), outcomeInvalidInput
+	}
+
+	// Validate the fallback URL up front so it is never fetched unchecked
+	if input.FallbackURL != "" && (!isValidURL(input.FallbackURL) || !isAllowedPort(input.FallbackURL)) {
+		log.Printf("Invalid fallback URL: %s", input.FallbackURL)
+		return newErrorPayload("Invalid fallback URL", input.URL, resultInvalidInput), outcomeInvalidInput
+	}
+
+	// Validate method
+	if !isValidMethod(input.method()) {
+		log.Printf("Invalid method: %s", input.Method)
+		return newErrorPayload("Invalid method", input.URL, resultInvalidInput), outcomeInvalidInput
+	}
+
+	// Validate sample count
+	if input.Samples < 0 || input.Samples > maxSamples {
+		log.Printf("Invalid sample count %d for %s", input.Samples, input.URL)
+		return newErrorPayload("Invalid sample count", input.URL, resultInvalidInput), outcomeInvalidInput
+	}
+
+	// One deadline covers every sample, retry and fallback fetch of the URL
+	if config.MaxTotalDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.MaxTotalDuration)
+		defer cancel()
+	}
+
+	// Resolve the host only, skipping the request entirely
+	if input.ResolveOnly {
+		output, err := resolveHost(ctx, input)
+		if err != nil {
+			log.Printf("Error resolving host of %s: %v", input.URL, err)
+			return newErrorPayload("Error resolving host", input.URL, errorResult(err)), fetchErrorOutcome(err)
+		}
+		return output, outcomeSuccess
+	}
+
+	// Fetch the URL and process the response
+	output, err := fetchWithFallback(ctx, input)
+	if err != nil {
+		log.Printf("Error fetching URL %s: %v", input.URL, err)
+		errorPayload := newErrorPayload("Error fetching URL", input.URL, errorResult(err))
+		errorPayload.AbortedOnTTFB = errors.Is(err, errTTFBBudgetExceeded)
+		return errorPayload, fetchErrorOutcome(err)
+	}
+
+	return output, outcomeSuccess
+}
+
+// fetchWithFallback fetches the URL, trying the payload's fallback URL when the primary fails to connect, times
+// out or responds with a 5xx; the output keeps the primary URL and records the URL that produced it
+func fetchWithFallback(ctx context.Context, input InputPayload) (*OutputPayload, error) {
+	output, err := fetchSamples(ctx, input)
+	if input.FallbackURL == "" {
+		return output, err
+	}
+	if shouldRetry(output, err) {
+		log.Printf("Primary URL %s failed, trying fallback %s", input.URL, input.FallbackURL)
+		fallback := input
+		fallback.URL = input.FallbackURL
+		fallbackOutput, fallbackErr := fetchSamples(ctx, fallback)
+		if fallbackErr != nil {
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Error fetching fallback URL %s: %v", input.FallbackURL, fallbackErr)
+		} else {
+			fallbackOutput.URL = input.URL
+			fallbackOutput.UsedURL = input.FallbackURL
+			return fallbackOutput, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	output.UsedURL = input.URL
+	return output, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// collectBatchHandler collects the requests posted as a JSON array of InputPayload one after another, exactly as
+// a Pub/Sub message carrying the array would be, and responds with the array of outputs in request order,
+// redacted like /recent so the endpoint cannot be used to read response bodies or credentials
+func collectBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if shedUnderMemoryPressure() {
+		http.Error(w, "Memory pressure, retry later", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading batch request body: %v", err)
+		http.Error(w, "Cannot read body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	requests, _, err := parseInput(r.Context(), string(body))
+	var listErr *urlListError
+	if errors.As(err, &listErr) {
+		log.Printf("Error loading URL list: %v", err)
+		status := http.StatusBadGateway
+		if listErr.outcome() == outcomeInvalidInput {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, "Error reading URL list", status)
+		return
+	}
+	if err != nil {
+		log.Printf("Error unmarshalling batch request JSON: %v", err)
+		http.Error(w, "Error unmarshalling input JSON", http.StatusBadRequest)
+		return
+	}
+	if len(requests) == 0 {
+		http.Error(w, "No URLs requested", http.StatusBadRequest)
+		return
+	}
+	if reason := batchSizeError(requests); reason != "" {
+		http.Error(w, reason, http.StatusBadRequest)
+		return
+	}
+
+	// The outputs are published as well as returned, so the sinks see the same results as for Pub/Sub
+	batch := &BatchInfo{BatchID: uuid.NewString(), BatchSize: len(requests)}
+	outputs := make([]*OutputPayload, len(requests))
+	for i, request := range requests {
+		output, _ := collectAndPublish(r.Context(), request, batch.at(i))
+		outputs[i] = redactOutput(output)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(outputs); err != nil {
+		log.Printf("Error encoding batch outputs: %v", err)
+	}
+}
@@ -0,0 +1,806 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime configuration loaded from environment variables
+type Config struct {
+	// HandlerStatus maps a handler outcome to the HTTP status code returned to Pub/Sub
+	HandlerStatus map[handlerOutcome]int
+
+	// UserAgentSuffix is appended to the default User-Agent of outbound requests
+	UserAgentSuffix string
+
+	// CaptureContentTypes lists the content types whose bodies are stored; empty stores every body
+	CaptureContentTypes []string
+
+	// FetchJitter is the upper bound of the random delay applied before each fetch
+	FetchJitter time.Duration
+
+	// FetchRetries is the number of additional attempts made after a failed fetch
+	FetchRetries int
+
+	// RetryIfBodyContains retries 2xx responses whose body contains the substring
+	RetryIfBodyContains string
+
+	// RetryDelay is the backoff before the first retry, doubling on each subsequent retry
+	RetryDelay time.Duration
+
+	// MaxTotalDuration bounds the whole fetch including all retries; zero means unbounded
+	MaxTotalDuration time.Duration
+
+	// BodyReadTimeout bounds reading the response body once the headers arrive; zero means unbounded
+	BodyReadTimeout time.Duration
+
+	// SameHostRedirectsOnly stops following redirects that leave the original host
+	SameHostRedirectsOnly bool
+
+	// FollowMetaRefresh follows <meta http-equiv="refresh"> redirects in HTML responses
+	FollowMetaRefresh bool
+
+	// SlowThreshold is the response time above which a response is flagged as slow; zero disables the flag
+	SlowThreshold time.Duration
+
+	// TTFBBudget abandons a fetch whose first response byte takes longer than this; zero disables it
+	TTFBBudget time.Duration
+
+	// AllowedPorts restricts the destination ports that may be fetched; empty allows every port
+	AllowedPorts []int
+
+	// BodyGCSBucket is the Cloud Storage bucket large response bodies are streamed to; empty disables streaming
+	BodyGCSBucket string
+
+	// BodyGCSPrefix is the object name prefix for bodies written to BodyGCSBucket
+	BodyGCSPrefix string
+
+	// BodyStreamThreshold is the body size in bytes above which bodies are streamed to BodyGCSBucket
+	BodyStreamThreshold int64
+
+	// WarmupHosts lists hosts requested at startup to pre-resolve DNS and pre-open pooled connections
+	WarmupHosts []string
+
+	// ProjectID is the GCP project hosting the Pub/Sub topics
+	ProjectID string
+
+	// ResponseTopic is the Pub/Sub topic responses are published to; empty only logs them
+	ResponseTopic string
+
+	// PublishDelayThreshold, PublishCountThreshold, and PublishByteThreshold tune the publisher's batching;
+	// zero keeps the Pub/Sub library defaults
+	PublishDelayThreshold time.Duration
+	PublishCountThreshold int
+	PublishByteThreshold  int
+
+	// TransformScript is the Starlark source of the body transform, loaded from TRANSFORM_SCRIPT or TRANSFORM_SCRIPT_FILE
+	TransformScript string `config:"secret"`
+
+	// TransformScriptName identifies the transform script in error messages
+	TransformScriptName string
+
+	// BodyTemplate is a text/template rendered with the request payload as the body of requests without one
+	BodyTemplate string `config:"secret"`
+
+	// RawBodyAlways stores the raw body text in ResponseBody even when it is also stored as ResponseJson
+	RawBodyAlways bool
+
+	// RetryJitter selects how the retry backoff is randomized: "none", "full", or "equal"
+	RetryJitter string
+
+	// MaxBodyBytes is the default maximum number of response body bytes read per fetch
+	MaxBodyBytes int64
+
+	// MaxBodyBytesHardLimit caps the body limit a payload may request with maxBodyBytes
+	MaxBodyBytesHardLimit int64
+
+	// StatusCacheSize is the number of URLs whose last status is remembered to detect changes; zero disables it
+	StatusCacheSize int
+
+	// DedupByHash handles outputs whose body is unchanged: "off", "mark" drops the body, "suppress" skips publishing
+	DedupByHash string
+
+	// DedupCacheSize is the number of URLs whose last body hash is remembered for DedupByHash
+	DedupCacheSize int
+
+	// OnPubSubFail selects what happens when the response topic is unavailable at startup: "fatal", "log", or "fallback"
+	OnPubSubFail string
+
+	// FallbackTopic is the Pub/Sub topic used instead of ResponseTopic when OnPubSubFail is "fallback"
+	FallbackTopic string
+
+	// BatchPartialFailureMode decides how a batch where only some URLs failed is acknowledged: "nack_all",
+	// "ack_all" or "republish_failed"
+	BatchPartialFailureMode string
+
+	// InputTopic is the Pub/Sub topic failed batch items with "republish_failed" and large URL lists are
+	// re-published to
+	InputTopic string
+
+	// RepublishMaxAttempts caps how many times a failed batch item is re-published before it is redelivered
+	RepublishMaxAttempts int
+
+	// DefaultQuery holds query parameters added to every request URL that does not already set them
+	DefaultQuery url.Values `config:"secret"`
+
+	// GlobalRPS caps the outbound requests per second across the instance; zero is unlimited
+	GlobalRPS float64
+
+	// RateLimitRules cap the requests per second to matching hosts and paths, the first matching rule applying
+	RateLimitRules []RateLimitRule
+
+	// RecentBufferSize is the number of recent outputs kept in memory for the /recent endpoint; zero disables it
+	RecentBufferSize int
+
+	// EnableCollectBatch registers the test-only POST /collect/batch endpoint
+	EnableCollectBatch bool
+
+	// OutputFields lists the JSON fields included in published outputs; empty includes every field
+	OutputFields []string
+
+	// OutputFieldMap renames JSON fields of published outputs, keyed by the default field name
+	OutputFieldMap map[string]string
+
+	// RetryBackoffMode selects whether the delay between retries is "constant" or "exponential"
+	RetryBackoffMode string
+
+	// BodyPrefixBytes limits every body to its first bytes regardless of other limits; zero reads whole bodies
+	BodyPrefixBytes int64
+
+	// RequestAuthMode selects how outbound requests are signed: "none", "gcp_oidc", or "aws_sigv4"
+	RequestAuthMode string
+
+	// RequestAuthAudience is the ID token audience for gcp_oidc; empty uses the origin of each request URL
+	RequestAuthAudience string
+
+	// RequestAuthHosts lists the lowercase hostnames requests are signed for; requests to other hosts are sent
+	// without credentials
+	RequestAuthHosts []string
+
+	// AWSRegion and AWSService scope aws_sigv4 signatures
+	AWSRegion  string
+	AWSService string
+
+	// AWSAccessKeyID, AWSSecretAccessKey, and AWSSessionToken are the credentials used for aws_sigv4
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string `config:"secret"`
+	AWSSessionToken    string `config:"secret"`
+
+	// AllowlistFailMode decides URLs the allowlist cannot evaluate: "closed" rejects them and "open" allows them
+	AllowlistFailMode string
+
+	// DialTimeout and TLSHandshakeTimeout bound the connection phases of a fetch; zero keeps the Go defaults
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+
+	// TLSMinVersion is the lowest TLS version negotiated, such as "1.2"
+	TLSMinVersion string
+
+	// CheckRevocation queries the OCSP status of the leaf certificate of https responses
+	CheckRevocation bool
+
+	// SOCKS5Proxy is the socks5:// URL of a proxy every connection is dialed through; empty dials directly
+	SOCKS5Proxy string `config:"secret"`
+
+	// OutputFormat selects how published messages are encoded: "raw", "cloudevents" or "warc"
+	OutputFormat string
+
+	// CloudEventsSource and CloudEventsType set the source and type of CloudEvents envelopes
+	CloudEventsSource string
+	CloudEventsType   string
+
+	// FollowRedirectCodes lists the redirect statuses that are followed; empty follows every redirect
+	FollowRedirectCodes []int
+
+	// IdleConnTimeout closes pooled connections left idle this long; zero keeps the Go default
+	IdleConnTimeout time.Duration
+
+	// DisableKeepAlive opens a new connection for every request instead of pooling connections
+	DisableKeepAlive bool
+
+	// ReadBufferSize and WriteBufferSize size the per-connection buffers in bytes; zero keeps the Go default of 4 KiB
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// MaxConnLifetime retires pooled connections this long after they were opened; zero keeps them indefinitely
+	MaxConnLifetime time.Duration
+
+	// CaptureRawRequest records each request as serialized on the wire, and CaptureRawRequestBody includes its body
+	CaptureRawRequest     bool
+	CaptureRawRequestBody bool
+
+	// CaptureRawResponse records the status line and headers of each response in wire format
+	CaptureRawResponse bool
+
+	// MaxBatchSize caps how many URLs a single message may request inline; zero is unlimited
+	MaxBatchSize int
+
+	// MaxURLListSize caps how many URLs a message may load from urlsGcs lists; zero is unlimited
+	MaxURLListSize int
+
+	// MaxHeapBytes is the heap size above which new requests are refused with 503; zero disables the guard
+	MaxHeapBytes int64
+
+	// CaptureBody reads and stores response bodies; when false only status, headers, and timing are recorded
+	CaptureBody bool
+
+	// NoStoreContentTypes lists content types whose bodies are never stored, taking precedence over CaptureContentTypes
+	NoStoreContentTypes []string
+
+	// ExpectedSubscription is the Pub/Sub subscription pushed messages must come from; empty accepts any
+	ExpectedSubscription string
+
+	// MaxHeaders is the number of response headers captured, in sorted order; zero captures every header
+	MaxHeaders int
+
+	// KafkaBrokers and KafkaTopic select a Kafka topic outputs are produced to alongside Pub/Sub; empty disables it
+	KafkaBrokers []string
+	KafkaTopic   string
+
+	// RequestIDHeader names the request header carrying the Pub/Sub message ID; empty sends none
+	RequestIDHeader string
+
+	// OutputLabels are deployment labels stamped on every published output
+	OutputLabels map[string]string
+
+	// URLFromAttribute names the message attribute that carries the URL instead of the data; empty always decodes the data
+	URLFromAttribute string
+
+	// GCSArchiveBucket is the Cloud Storage bucket every published message is archived to as a gzipped object
+	GCSArchiveBucket string
+
+	// AnalyticsMode skips body capture and streams a reduced row of response metadata to BigQueryTable
+	AnalyticsMode bool
+	BigQueryTable string
+}
+
+// config is the active configuration, loaded once at startup
+var config = defaultConfig()
+
+// defaultConfig returns the configuration used when no environment variables are set
+func defaultConfig() *Config {
+	return &Config{
+		HandlerStatus:           defaultHandlerStatus(),
+		RetryDelay:              time.Second,
+		RetryJitter:             retryJitterFull,
+		RetryBackoffMode:        retryBackoffExponential,
+		RequestAuthMode:         requestAuthNone,
+		AllowlistFailMode:       allowlistFailClosed,
+		DedupByHash:             dedupOff,
+		BatchPartialFailureMode: batchNackAll,
+		RepublishMaxAttempts:    5,
+		DedupCacheSize:          10000,
+		OutputFormat:            outputFormatRaw,
+		MaxBatchSize:            100,
+		MaxURLListSize:          1000,
+		CaptureBody:             true,
+		CloudEventsSource:       "//http-response-collector",
+		CloudEventsType:         "com.unitvectorylabs.http-response-collector.response",
+		AWSService:              "execute-api",
+		OnPubSubFail:            pubsubFailLog,
+		BodyStreamThreshold:     1024 * 1024,
+		MaxBodyBytes:            10 * 1024 * 1024,
+		MaxBodyBytesHardLimit:   100 * 1024 * 1024,
+		TLSMinVersion:           "1.2",
+	}
+}
+
+// loadConfig reads the configuration from environment variables
+func loadConfig() (*Config, error) {
+	cfg := defaultConfig()
+
+	if err := parseHandlerStatus(os.Getenv("HANDLER_STATUS_MAP"), cfg.HandlerStatus); err != nil {
+		return nil, fmt.Errorf("HANDLER_STATUS_MAP: %w", err)
+	}
+
+	cfg.UserAgentSuffix = strings.TrimSpace(os.Getenv("USER_AGENT_SUFFIX"))
+
+	cfg.CaptureContentTypes = splitList(strings.ToLower(os.Getenv("CAPTURE_CONTENT_TYPES")))
+	cfg.CaptureContentTypes = append(cfg.CaptureContentTypes, splitList(strings.ToLower(os.Getenv("STORE_CONTENT_TYPES")))...)
+	cfg.NoStoreContentTypes = splitList(strings.ToLower(os.Getenv("NO_STORE_CONTENT_TYPES")))
+
+	jitterMs, err := envInt("FETCH_JITTER_MS", 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.FetchJitter = time.Duration(jitterMs) * time.Millisecond
+
+	if cfg.FetchRetries, err = envInt("FETCH_RETRIES", 0); err != nil {
+		return nil, err
+	}
+	cfg.RetryIfBodyContains = os.Getenv("RETRY_IF_BODY_CONTAINS")
+	if cfg.RetryDelay, err = envDuration("RETRY_DELAY", cfg.RetryDelay); err != nil {
+		return nil, err
+	}
+	if cfg.MaxTotalDuration, err = envDuration("MAX_TOTAL_DURATION", 0); err != nil {
+		return nil, err
+	}
+	if cfg.BodyReadTimeout, err = envDuration("BODY_READ_TIMEOUT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.SameHostRedirectsOnly, err = envBool("SAME_HOST_REDIRECTS_ONLY", false); err != nil {
+		return nil, err
+	}
+	if cfg.FollowMetaRefresh, err = envBool("FOLLOW_META_REFRESH", false); err != nil {
+		return nil, err
+	}
+
+	slowMs, err := envInt("SLOW_THRESHOLD_MS", 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.SlowThreshold = time.Duration(slowMs) * time.Millisecond
+
+	ttfbMs, err := envInt("TTFB_BUDGET_MS", 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.TTFBBudget = time.Duration(ttfbMs) * time.Millisecond
+
+	for _, entry := range splitList(os.Getenv("ALLOWED_PORTS")) {
+		port, err := strconv.Atoi(entry)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("ALLOWED_PORTS: invalid port %q", entry)
+		}
+		cfg.AllowedPorts = append(cfg.AllowedPorts, port)
+	}
+
+	cfg.BodyGCSBucket = strings.TrimSpace(os.Getenv("BODY_GCS_BUCKET"))
+	cfg.BodyGCSPrefix = strings.Trim(os.Getenv("BODY_GCS_PREFIX"), "/ ")
+
+	streamThreshold, err := envInt("BODY_STREAM_THRESHOLD", int(cfg.BodyStreamThreshold))
+	if err != nil {
+		return nil, err
+	}
+
+	// INLINE_BODY_MAX names the same threshold from the inlining side and wins when both are set
+	if os.Getenv("INLINE_BODY_MAX") != "" && cfg.BodyGCSBucket == "" {
+		return nil, fmt.Errorf("INLINE_BODY_MAX: requires BODY_GCS_BUCKET to store larger bodies")
+	}
+	if streamThreshold, err = envInt("INLINE_BODY_MAX", streamThreshold); err != nil {
+		return nil, err
+	}
+	cfg.BodyStreamThreshold = int64(streamThreshold)
+
+	cfg.WarmupHosts = splitList(os.Getenv("WARMUP_HOSTS"))
+
+	cfg.ProjectID = strings.TrimSpace(os.Getenv("GOOGLE_CLOUD_PROJECT"))
+	cfg.ResponseTopic = strings.TrimSpace(os.Getenv("RESPONSE_PUBSUB"))
+
+	if cfg.PublishDelayThreshold, err = envDuration("PUBLISH_DELAY_THRESHOLD", 0); err != nil {
+		return nil, err
+	}
+	if cfg.PublishCountThreshold, err = envInt("PUBLISH_COUNT_THRESHOLD", 0); err != nil {
+		return nil, err
+	}
+	if cfg.PublishByteThreshold, err = envInt("PUBLISH_BYTE_THRESHOLD", 0); err != nil {
+		return nil, err
+	}
+
+	cfg.BodyTemplate = os.Getenv("BODY_TEMPLATE")
+
+	cfg.TransformScript = os.Getenv("TRANSFORM_SCRIPT")
+	cfg.TransformScriptName = "TRANSFORM_SCRIPT"
+	if path := strings.TrimSpace(os.Getenv("TRANSFORM_SCRIPT_FILE")); path != "" {
+		script, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("TRANSFORM_SCRIPT_FILE: %w", err)
+		}
+		cfg.TransformScript = string(script)
+		cfg.TransformScriptName = path
+	}
+
+	if cfg.RawBodyAlways, err = envBool("RAW_BODY_ALWAYS", false); err != nil {
+		return nil, err
+	}
+
+	if jitter := strings.ToLower(strings.TrimSpace(os.Getenv("RETRY_JITTER"))); jitter != "" {
+		if jitter != retryJitterNone && jitter != retryJitterFull && jitter != retryJitterEqual {
+			return nil, fmt.Errorf("RETRY_JITTER: unknown strategy %q", jitter)
+		}
+		cfg.RetryJitter = jitter
+	}
+
+	maxBodyBytes, err := envInt("MAX_BODY_BYTES", int(cfg.MaxBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxBodyBytes = int64(maxBodyBytes)
+
+	hardLimit, err := envInt("MAX_BODY_BYTES_HARD_LIMIT", int(cfg.MaxBodyBytesHardLimit))
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxBodyBytesHardLimit = int64(hardLimit)
+
+	if cfg.StatusCacheSize, err = envInt("STATUS_CACHE_SIZE", 0); err != nil {
+		return nil, err
+	}
+
+	if mode := strings.ToLower(strings.TrimSpace(os.Getenv("DEDUP_BY_HASH"))); mode != "" {
+		if mode != dedupOff && mode != dedupMark && mode != dedupSuppress {
+			return nil, fmt.Errorf("DEDUP_BY_HASH: unknown mode %q", mode)
+		}
+		cfg.DedupByHash = mode
+	}
+	if cfg.DedupCacheSize, err = envInt("DEDUP_CACHE_SIZE", cfg.DedupCacheSize); err != nil {
+		return nil, err
+	}
+
+	if mode := strings.ToLower(strings.TrimSpace(os.Getenv("ON_PUBSUB_FAIL"))); mode != "" {
+		if mode != pubsubFailFatal && mode != pubsubFailLog && mode != pubsubFailFallback {
+			return nil, fmt.Errorf("ON_PUBSUB_FAIL: unknown mode %q", mode)
+		}
+		cfg.OnPubSubFail = mode
+	}
+	cfg.FallbackTopic = strings.TrimSpace(os.Getenv("FALLBACK_PUBSUB"))
+	if cfg.OnPubSubFail == pubsubFailFallback && cfg.FallbackTopic == "" {
+		return nil, fmt.Errorf("ON_PUBSUB_FAIL: fallback requires FALLBACK_PUBSUB")
+	}
+
+	if mode := strings.ToLower(strings.TrimSpace(os.Getenv("BATCH_PARTIAL_FAILURE_MODE"))); mode != "" {
+		if mode != batchAckAll && mode != batchNackAll && mode != batchRepublishFailed {
+			return nil, fmt.Errorf("BATCH_PARTIAL_FAILURE_MODE: unknown mode %q", mode)
+		}
+		cfg.BatchPartialFailureMode = mode
+	}
+	cfg.InputTopic = strings.TrimSpace(os.Getenv("INPUT_PUBSUB"))
+	if cfg.RepublishMaxAttempts, err = envInt("REPUBLISH_MAX_ATTEMPTS", cfg.RepublishMaxAttempts); err != nil {
+		return nil, err
+	}
+	if cfg.BatchPartialFailureMode == batchRepublishFailed && (cfg.InputTopic == "" || cfg.ProjectID == "") {
+		return nil, fmt.Errorf("BATCH_PARTIAL_FAILURE_MODE: republish_failed requires INPUT_PUBSUB and GOOGLE_CLOUD_PROJECT")
+	}
+	if cfg.InputTopic != "" && cfg.ProjectID == "" {
+		return nil, fmt.Errorf("INPUT_PUBSUB requires GOOGLE_CLOUD_PROJECT")
+	}
+
+	if cfg.DefaultQuery, err = url.ParseQuery(strings.TrimSpace(os.Getenv("DEFAULT_QUERY"))); err != nil {
+		return nil, fmt.Errorf("DEFAULT_QUERY: %w", err)
+	}
+
+	if cfg.GlobalRPS, err = envFloat("GLOBAL_RPS", 0); err != nil {
+		return nil, err
+	}
+	if rules := os.Getenv("RATE_LIMIT_RULES"); rules != "" {
+		if err := json.Unmarshal([]byte(rules), &cfg.RateLimitRules); err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_RULES: %w", err)
+		}
+		for i, rule := range cfg.RateLimitRules {
+			if rule.RPS <= 0 {
+				return nil, fmt.Errorf("RATE_LIMIT_RULES: rule %d must have a positive rps", i)
+			}
+		}
+	}
+
+	if cfg.RecentBufferSize, err = envInt("RECENT_BUFFER_SIZE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.EnableCollectBatch, err = envBool("ENABLE_COLLECT_BATCH", false); err != nil {
+		return nil, err
+	}
+
+	cfg.OutputFields = splitList(os.Getenv("OUTPUT_FIELDS"))
+	for _, name := range cfg.OutputFields {
+		if !slices.Contains(outputFieldNames(), name) {
+			return nil, fmt.Errorf("OUTPUT_FIELDS: unknown field %q", name)
+		}
+	}
+
+	if fieldMap := os.Getenv("OUTPUT_FIELD_MAP"); fieldMap != "" {
+		if err := json.Unmarshal([]byte(fieldMap), &cfg.OutputFieldMap); err != nil {
+			return nil, fmt.Errorf("OUTPUT_FIELD_MAP: %w", err)
+		}
+		for name, key := range cfg.OutputFieldMap {
+			if !slices.Contains(outputFieldNames(), name) {
+				return nil, fmt.Errorf("OUTPUT_FIELD_MAP: unknown field %q", name)
+			}
+			if key == "" {
+				return nil, fmt.Errorf("OUTPUT_FIELD_MAP: empty name for field %q", name)
+			}
+		}
+	}
+
+	if mode := strings.ToLower(strings.TrimSpace(os.Getenv("RETRY_BACKOFF_MODE"))); mode != "" {
+		if mode != retryBackoffConstant && mode != retryBackoffExponential {
+			return nil, fmt.Errorf("RETRY_BACKOFF_MODE: unknown mode %q", mode)
+		}
+		cfg.RetryBackoffMode = mode
+	}
+
+	prefixBytes, err := envInt("BODY_PREFIX_BYTES", 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.BodyPrefixBytes = int64(prefixBytes)
+
+	if mode := strings.ToLower(strings.TrimSpace(os.Getenv("REQUEST_AUTH_MODE"))); mode != "" {
+		if mode != requestAuthNone && mode != requestAuthGCPOIDC && mode != requestAuthAWSSigV4 {
+			return nil, fmt.Errorf("REQUEST_AUTH_MODE: unknown mode %q", mode)
+		}
+		cfg.RequestAuthMode = mode
+	}
+	cfg.RequestAuthAudience = strings.TrimSpace(os.Getenv("REQUEST_AUTH_AUDIENCE"))
+	cfg.RequestAuthHosts = splitList(strings.ToLower(os.Getenv("REQUEST_AUTH_HOSTS")))
+	if cfg.RequestAuthMode != requestAuthNone && len(cfg.RequestAuthHosts) == 0 {
+		return nil, fmt.Errorf("REQUEST_AUTH_MODE: %s requires REQUEST_AUTH_HOSTS", cfg.RequestAuthMode)
+	}
+	cfg.AWSRegion = strings.TrimSpace(cmp.Or(os.Getenv("AWS_SIGV4_REGION"), os.Getenv("AWS_REGION")))
+	cfg.AWSService = cmp.Or(strings.TrimSpace(os.Getenv("AWS_SIGV4_SERVICE")), cfg.AWSService)
+	cfg.AWSAccessKeyID = strings.TrimSpace(os.Getenv("AWS_ACCESS_KEY_ID"))
+	cfg.AWSSecretAccessKey = strings.TrimSpace(os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	cfg.AWSSessionToken = strings.TrimSpace(os.Getenv("AWS_SESSION_TOKEN"))
+	if cfg.RequestAuthMode == requestAuthAWSSigV4 && (cfg.AWSRegion == "" || cfg.AWSAccessKeyID == "" || cfg.AWSSecretAccessKey == "") {
+		return nil, fmt.Errorf("REQUEST_AUTH_MODE: aws_sigv4 requires AWS_SIGV4_REGION, AWS_ACCESS_KEY_ID, and AWS_SECRET_ACCESS_KEY")
+	}
+
+	if mode := strings.ToLower(strings.TrimSpace(os.Getenv("ALLOWLIST_FAIL_MODE"))); mode != "" {
+		if mode != allowlistFailOpen && mode != allowlistFailClosed {
+			return nil, fmt.Errorf("ALLOWLIST_FAIL_MODE: unknown mode %q", mode)
+		}
+		cfg.AllowlistFailMode = mode
+	}
+
+	if cfg.DialTimeout, err = envDuration("DIAL_TIMEOUT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.TLSHandshakeTimeout, err = envDuration("TLS_HANDSHAKE_TIMEOUT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.SOCKS5Proxy = strings.TrimSpace(os.Getenv("SOCKS5_PROXY")); cfg.SOCKS5Proxy != "" {
+		if _, err := socks5Dialer(cfg.SOCKS5Proxy, &net.Dialer{}); err != nil {
+			return nil, fmt.Errorf("SOCKS5_PROXY: %w", err)
+		}
+	}
+	if cfg.CheckRevocation, err = envBool("CHECK_REVOCATION", false); err != nil {
+		return nil, err
+	}
+	if version := strings.TrimSpace(os.Getenv("TLS_MIN_VERSION")); version != "" {
+		if _, ok := tlsVersions[version]; !ok {
+			return nil, fmt.Errorf("TLS_MIN_VERSION: unknown version %q", version)
+		}
+		cfg.TLSMinVersion = version
+	}
+
+	if format := strings.ToLower(strings.TrimSpace(os.Getenv("OUTPUT_FORMAT"))); format != "" {
+		if format != outputFormatRaw && format != outputFormatCloudEvents && format != outputFormatWARC {
+			return nil, fmt.Errorf("OUTPUT_FORMAT: unknown format %q", format)
+		}
+		cfg.OutputFormat = format
+	}
+	cfg.CloudEventsSource = cmp.Or(strings.TrimSpace(os.Getenv("CLOUDEVENTS_SOURCE")), cfg.CloudEventsSource)
+	cfg.CloudEventsType = cmp.Or(strings.TrimSpace(os.Getenv("CLOUDEVENTS_TYPE")), cfg.CloudEventsType)
+
+	for _, entry := range splitList(os.Getenv("FOLLOW_REDIRECT_CODES")) {
+		code, err := strconv.Atoi(entry)
+		if err != nil || code < 300 || code > 399 {
+			return nil, fmt.Errorf("FOLLOW_REDIRECT_CODES: invalid redirect status %q", entry)
+		}
+		cfg.FollowRedirectCodes = append(cfg.FollowRedirectCodes, code)
+	}
+
+	if cfg.IdleConnTimeout, err = envDuration("IDLE_CONN_TIMEOUT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.DisableKeepAlive, err = envBool("DISABLE_KEEP_ALIVE", false); err != nil {
+		return nil, err
+	}
+	if cfg.ReadBufferSize, err = envInt("READ_BUFFER_SIZE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.WriteBufferSize, err = envInt("WRITE_BUFFER_SIZE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MaxConnLifetime, err = envDuration("MAX_CONN_LIFETIME", 0); err != nil {
+		return nil, err
+	}
+
+	if cfg.CaptureRawRequest, err = envBool("CAPTURE_RAW_REQUEST", false); err != nil {
+		return nil, err
+	}
+	if cfg.CaptureRawRequestBody, err = envBool("CAPTURE_RAW_REQUEST_BODY", false); err != nil {
+		return nil, err
+	}
+
+	if cfg.CaptureRawResponse, err = envBool("CAPTURE_RAW_RESPONSE", false); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxBatchSize, err = envInt("MAX_BATCH_SIZE", cfg.MaxBatchSize); err != nil {
+		return nil, err
+	}
+	if cfg.MaxURLListSize, err = envInt("MAX_URL_LIST_SIZE", cfg.MaxURLListSize); err != nil {
+		return nil, err
+	}
+	maxHeapBytes, err := envInt("MAX_HEAP_BYTES", 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxHeapBytes = int64(maxHeapBytes)
+
+	if cfg.CaptureBody, err = envBool("CAPTURE_BODY", cfg.CaptureBody); err != nil {
+		return nil, err
+	}
+
+	cfg.ExpectedSubscription = strings.TrimSpace(os.Getenv("EXPECTED_SUBSCRIPTION"))
+
+	if cfg.MaxHeaders, err = envInt("MAX_HEADERS", 0); err != nil {
+		return nil, err
+	}
+
+	cfg.KafkaBrokers = splitList(os.Getenv("KAFKA_BROKERS"))
+	cfg.KafkaTopic = strings.TrimSpace(os.Getenv("KAFKA_TOPIC"))
+	if (len(cfg.KafkaBrokers) > 0) != (cfg.KafkaTopic != "") {
+		return nil, fmt.Errorf("KAFKA_BROKERS and KAFKA_TOPIC must be set together")
+	}
+
+	cfg.RequestIDHeader = strings.TrimSpace(os.Getenv("REQUEST_ID_HEADER"))
+
+	if labels := os.Getenv("OUTPUT_LABELS"); labels != "" {
+		if err := json.Unmarshal([]byte(labels), &cfg.OutputLabels); err != nil {
+			return nil, fmt.Errorf("OUTPUT_LABELS: %w", err)
+		}
+	}
+
+	cfg.URLFromAttribute = strings.TrimSpace(os.Getenv("URL_FROM_ATTRIBUTE"))
+
+	if cfg.AnalyticsMode, err = envBool("ANALYTICS_MODE", false); err != nil {
+		return nil, err
+	}
+	cfg.GCSArchiveBucket = strings.TrimSpace(os.Getenv("GCS_ARCHIVE_BUCKET"))
+
+	cfg.BigQueryTable = strings.TrimSpace(os.Getenv("BIGQUERY_TABLE"))
+	if cfg.AnalyticsMode {
+		if _, _, _, err := parseBigQueryTable(cfg.BigQueryTable, cfg.ProjectID); err != nil {
+			return nil, fmt.Errorf("BIGQUERY_TABLE: %w", err)
+		}
+		cfg.CaptureBody = false
+	}
+
+	return cfg, nil
+}
+
+// redacted returns the configuration as a JSON-friendly map keyed by field name, formatting durations as
+// strings and masking fields tagged `config:"secret"`
+func (c *Config) redacted() map[string]any {
+	view := make(map[string]any)
+	value := reflect.ValueOf(c).Elem()
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		key := strings.ToLower(field.Name[:1]) + field.Name[1:]
+
+		switch {
+		case field.Tag.Get("config") == "secret" && !isEmptyValue(value.Field(i)):
+			view[key] = "REDACTED"
+		case field.Type == reflect.TypeFor[time.Duration]():
+			view[key] = time.Duration(value.Field(i).Int()).String()
+		default:
+			view[key] = value.Field(i).Interface()
+		}
+	}
+	return view
+}
+
+// isEmptyValue reports whether a configuration value is unset, treating empty maps and slices like nil ones
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// configHandler returns the effective configuration with secrets redacted
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(config.redacted()); err != nil {
+		log.Printf("Error encoding configuration: %v", err)
+	}
+}
+
+// envInt reads a non-negative integer environment variable, returning def when it is unset
+func envInt(name string, def int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s: invalid non-negative integer %q", name, value)
+	}
+	return n, nil
+}
+
+// envFloat reads a non-negative number environment variable such as "0.5", returning def when it is unset
+func envFloat(name string, def float64) (float64, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("%s: invalid non-negative number %q", name, value)
+	}
+	return f, nil
+}
+
+// envBool reads a boolean environment variable such as "true" or "0", returning def when it is unset
+func envBool(name string, def bool) (bool, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid boolean %q", name, value)
+	}
+	return b, nil
+}
+
+// envDuration reads a non-negative Go duration environment variable such as "1500ms", returning def when it is unset
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s: invalid duration %q", name, value)
+	}
+	return d, nil
+}
+
+// parseHandlerStatus applies overrides in the form "outcome=code,outcome=code" to the status map
+func parseHandlerStatus(value string, statusMap map[handlerOutcome]int) error {
+	for _, pair := range splitList(value) {
+		name, code, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid entry %q, expected outcome=code", pair)
+		}
+
+		outcome := handlerOutcome(strings.TrimSpace(name))
+		if _, known := statusMap[outcome]; !known {
+			return fmt.Errorf("unknown outcome %q", outcome)
+		}
+
+		status, err := strconv.Atoi(strings.TrimSpace(code))
+		if err != nil || status < 100 || status > 599 {
+			return fmt.Errorf("invalid status code %q for outcome %q", code, outcome)
+		}
+		statusMap[outcome] = status
+	}
+	return nil
+}
+
+// splitList splits a comma-separated value into its trimmed, non-empty entries
+func splitList(value string) []string {
+	var entries []string
+	for entry := range strings.SplitSeq(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
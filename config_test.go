@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+// setConfig replaces the global configuration with the defaults changed by update for the duration of the test
+func setConfig(t *testing.T, update func(c *Config)) {
+	t.Helper()
+	previous := config
+	t.Cleanup(func() { config = previous })
+
+	config = defaultConfig()
+	if update != nil {
+		update(config)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   Config
+		field string
+		want  string
+	}{
+		{"secret string set", Config{BodyTemplate: "key={{.URL}}"}, "bodyTemplate", "REDACTED"},
+		{"secret string empty", Config{}, "bodyTemplate", ""},
+		{"secret map set", Config{DefaultQuery: url.Values{"key": {"abc"}}}, "defaultQuery", "REDACTED"},
+		{"secret map empty", Config{DefaultQuery: url.Values{}}, "defaultQuery", "map[]"},
+		{"plain value", Config{ResponseTopic: "responses"}, "responseTopic", "responses"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprint(tt.cfg.redacted()[tt.field]); got != tt.want {
+				t.Errorf("redacted()[%q] = %q, want %q", tt.field, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings the collector can decode
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+	encodingZstd    = "zstd"
+)
+
+// decodeBody decodes a body sent with the given Content-Encoding, returning at most limit decoded bytes and
+// whether the decoded body held more; an encoding of "" or identity is returned unchanged
+func decodeBody(encoding string, raw []byte, limit int64) ([]byte, bool, error) {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return raw, false, nil
+	case encodingGzip, "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, false, err
+		}
+		defer zr.Close()
+		r = zr
+	case encodingDeflate:
+		// RFC 9110 defines deflate as zlib-wrapped, but some servers send a raw deflate stream
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			zr = flate.NewReader(bytes.NewReader(raw))
+		}
+		defer zr.Close()
+		r = zr
+	case encodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(raw), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, false, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, false, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	decoded := newTruncatingReader(r, limit)
+	body, err := io.ReadAll(decoded)
+	if err != nil {
+		return nil, false, err
+	}
+	return body, decoded.truncated, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import "strconv"
+
+// Modes of DEDUP_BY_HASH
+const (
+	dedupOff      = "off"
+	dedupMark     = "mark"
+	dedupSuppress = "suppress"
+)
+
+// lastBodies is the shared cache of the last status code and body hash per URL, or nil when deduplication is
+// disabled
+var lastBodies *lruCache[string]
+
+// markUnchanged flags the output and drops its body when its status code and body hash match the last ones
+// observed for the URL and method, reporting whether it did
+func markUnchanged(output *OutputPayload) bool {
+	if lastBodies == nil || output.BodyHash == "" {
+		return false
+	}
+
+	fingerprint := strconv.Itoa(output.StatusCode) + ":" + output.BodyHash
+	previous, ok := lastBodies.swap(output.Method+" "+output.URL, fingerprint)
+	if !ok || previous != fingerprint {
+		return false
+	}
+
+	output.Unchanged = true
+	output.ResponseBody = ""
+	output.ResponseJson = ""
+	output.ResponseXml = ""
+	return true
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Fixed schedule of the DNS retry, kept short because it runs inside the request timeout
+const (
+	dnsRetryAttempts = 2
+	dnsRetryBackoff  = 100 * time.Millisecond
+)
+
+// dnsRetryCounterKey is the context key under which fetchURL stores the counter of DNS retries for a request
+type dnsRetryCounterKey struct{}
+
+// withDNSRetryCounter returns a context whose dials count their DNS retries in the counter
+func withDNSRetryCounter(ctx context.Context, counter *atomic.Int32) context.Context {
+	return context.WithValue(ctx, dnsRetryCounterKey{}, counter)
+}
+
+// isTransientDNSError reports whether the error is a DNS failure that may succeed if retried, such as a
+// SERVFAIL or a resolver timeout; a host that does not exist is not retried
+func isTransientDNSError(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && !dnsErr.IsNotFound
+}
+
+// dnsRetryDialer wraps a dial function so transient DNS failures are retried with a short backoff before the
+// dial gives up, separately from the retries of the whole fetch
+func dnsRetryDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		delay := dnsRetryBackoff
+		for attempt := 0; err != nil && isTransientDNSError(err) && attempt < dnsRetryAttempts; attempt++ {
+			log.Printf("Retrying DNS resolution of %s in %s after: %v", addr, delay, err)
+			if sleepContext(ctx, delay) != nil {
+				break
+			}
+			if counter, ok := ctx.Value(dnsRetryCounterKey{}).(*atomic.Int32); ok {
+				counter.Add(1)
+			}
+			delay *= 2
+			conn, err = dial(ctx, network, addr)
+		}
+		return conn, err
+	}
+}
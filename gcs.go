@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/storage/v1"
+)
+
+// gcsClient is the shared Cloud Storage service, created at startup when BODY_GCS_BUCKET is set or on first use
+var (
+	gcsClientMu sync.Mutex
+	gcsClient   *storage.Service
+)
+
+// storageService returns the shared Cloud Storage service, creating it if needed
+func storageService(ctx context.Context) (*storage.Service, error) {
+	gcsClientMu.Lock()
+	defer gcsClientMu.Unlock()
+
+	if gcsClient == nil {
+		client, err := storage.NewService(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		gcsClient = client
+	}
+	return gcsClient, nil
+}
+
+// storedBody describes a response body that was written to Cloud Storage instead of the output
+type storedBody struct {
+	ref  string
+	size int64
+	hash string
+}
+
+// readOrStreamBody reads the body into memory, or streams it to the body bucket once it grows past the
+// stream threshold, returning either the buffered bytes or a reference to the stored object
+func readOrStreamBody(ctx context.Context, body io.Reader, contentType string) ([]byte, *storedBody, error) {
+	if config.BodyGCSBucket == "" {
+		bodyBytes, err := io.ReadAll(body)
+		return bodyBytes, nil, err
+	}
+
+	head, err := io.ReadAll(io.LimitReader(body, config.BodyStreamThreshold+1))
+	if err != nil || int64(len(head)) <= config.BodyStreamThreshold {
+		return head, nil, err
+	}
+
+	stored, err := streamBodyToGCS(ctx, io.MultiReader(bytes.NewReader(head), body), contentType)
+	return nil, stored, err
+}
+
+// streamBodyToGCS copies the body into a new object in the body bucket, hashing it on the fly
+func streamBodyToGCS(ctx context.Context, body io.Reader, contentType string) (*storedBody, error) {
+	name := path.Join(config.BodyGCSPrefix, time.Now().UTC().Format("2006/01/02"), uuid.NewString())
+	object := &storage.Object{Name: name, ContentType: contentType}
+
+	// The upload is resumable in the smallest chunks the API accepts, so at most 256 KiB of the body is buffered
+	// at a time instead of the 16 MiB default; a failed read aborts it before the object is finalized
+	hasher := sha256.New()
+	counter := &countingReader{r: io.TeeReader(body, hasher)}
+	chunkSize := googleapi.ChunkSize(googleapi.MinUploadChunkSize)
+	_, err := gcsClient.Objects.Insert(config.BodyGCSBucket, object).Media(counter, chunkSize).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("writing body to GCS: %w", err)
+	}
+
+	return &storedBody{
+		ref:  fmt.Sprintf("gs://%s/%s", config.BodyGCSBucket, name),
+		size: counter.n,
+		hash: hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaSink produces published messages to a Kafka topic through a shared writer
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+// newKafkaSink returns a sink producing to KAFKA_TOPIC on the KAFKA_BROKERS, hashing message keys so every
+// message for a URL lands on the same partition
+func newKafkaSink() *kafkaSink {
+	return &kafkaSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(config.KafkaBrokers...),
+		Topic:        config.KafkaTopic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+// name implements sink
+func (k *kafkaSink) name() string {
+	return k.writer.Topic
+}
+
+// send implements sink, writing the message before returning
+func (k *kafkaSink) send(ctx context.Context, output *OutputPayload, data []byte, attributes map[string]string, done func(string, error)) {
+	done(k.deliver(ctx, output, data, attributes))
+}
+
+// deliver writes the message to the topic; Kafka assigns no message ID, so none is returned
+func (k *kafkaSink) deliver(ctx context.Context, output *OutputPayload, data []byte, attributes map[string]string) (string, error) {
+	key := sha256.Sum256([]byte(output.URL))
+	message := kafka.Message{Key: []byte(hex.EncodeToString(key[:])), Value: data}
+	for name, value := range attributes {
+		message.Headers = append(message.Headers, kafka.Header{Key: name, Value: []byte(value)})
+	}
+	return "", k.writer.WriteMessages(ctx, message)
+}
+
+// close flushes pending messages and closes the writer's connections
+func (k *kafkaSink) close() error {
+	return k.writer.Close()
+}
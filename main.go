@@ -2,23 +2,43 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"maps"
+	"math/rand/v2"
+	"mime"
 	"net/http"
-	"os"
+	"net/http/httptrace"
+	neturl "net/url"
 	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
-	"cloud.google.com/go/pubsub"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Version is the application version, injected at build time via ldflags
 var Version = "dev"
 
+// Commit is the git commit the application was built from, injected at build time via ldflags
+var Commit = "unknown"
+
 // PubSubMessage represents the structure of a Pub/Sub push message
 type PubSubMessage struct {
 	Message struct {
@@ -32,61 +52,202 @@ type PubSubMessage struct {
 
 // InputPayload represents the structure of the incoming JSON payload
 type InputPayload struct {
-	URL string `json:"url"`
+	URL                string            `json:"url"`
+	URLs               []string          `json:"urls,omitempty"`
+	Method             string            `json:"method,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	Body               string            `json:"body,omitempty"`
+	HostHeader         string            `json:"hostHeader,omitempty"`
+	CompressRequest    bool              `json:"compressRequest,omitempty"`
+	MaxBodyBytes       int               `json:"maxBodyBytes,omitempty"`
+	Samples            int               `json:"samples,omitempty"`
+	ServerName         string            `json:"serverName,omitempty"`
+	ResolveOnly        bool              `json:"resolveOnly,omitempty"`
+	AssertHeaders      map[string]string `json:"assertHeaders,omitempty"`
+	AssertBodyContains []string          `json:"assertBodyContains,omitempty"`
+	AssertIgnoreCase   bool              `json:"assertIgnoreCase,omitempty"`
+	URLsGCS            string            `json:"urlsGcs,omitempty"`
+	Methods            []string          `json:"methods,omitempty"`
+	FallbackURL        string            `json:"fallbackUrl,omitempty"`
+	DisableKeepAlive   bool              `json:"disableKeepAlive,omitempty"`
+	ProbeWebSocket     bool              `json:"probeWebSocket,omitempty"`
+
+	// groupID ties together the per-method requests expanded from a single request with Methods
+	groupID string
+
+	// messageID is the ID of the Pub/Sub message that requested the URL
+	messageID string
+
+	// listedURLs is the number of trailing URLs that were loaded from URLsGCS, and fromURLList marks a request
+	// expanded from one of them
+	listedURLs  int
+	fromURLList bool
 }
 
-// OutputPayload represents the structure of the processed data
-type OutputPayload struct {
-	URL          string `json:"url"`
-	Error        string `json:"error,omitempty"`
-	Headers      string `json:"headers,omitempty"`
-	ResponseBody string `json:"responseBody,omitempty"`
-	ResponseJson string `json:"responseJson,omitempty"`
-	ResponseTime int64  `json:"responseTime,omitzero"` // in milliseconds
-	RequestTime  string `json:"requestTime"`
-	StatusCode   int    `json:"statusCode,omitzero"`
-}
-
-// Updated publishMessage now publishes to the Pub/Sub topic if RESPONSE_PUBSUB is set.
-func publishMessage(message any) {
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshalling message for publishing: %v", err)
-		return
+// targets returns the URLs requested by the payload, in order
+func (p InputPayload) targets() []string {
+	if len(p.URLs) == 0 {
+		return []string{p.URL}
 	}
+	if p.URL != "" {
+		return append([]string{p.URL}, p.URLs...)
+	}
+	return p.URLs
+}
 
-	topicName := os.Getenv("RESPONSE_PUBSUB")
-	if topicName == "" {
-		log.Printf("Publish Message: %s", string(messageJSON))
-		return
+// expand returns one payload per requested URL, and per method when Methods is set, each sharing this
+// payload's request settings
+func (p InputPayload) expand() []InputPayload {
+	var requests []InputPayload
+	targets := p.targets()
+	for i, url := range targets {
+		request := p
+		request.URL = url
+		request.URLs = nil
+		request.listedURLs = 0
+		request.fromURLList = i >= len(targets)-p.listedURLs
+		if len(p.Methods) == 0 {
+			requests = append(requests, request)
+			continue
+		}
+
+		request.Methods = nil
+		request.groupID = uuid.NewString()
+		for _, method := range p.Methods {
+			request.Method = method
+			requests = append(requests, request)
+		}
 	}
+	return requests
+}
 
-	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
-	if projectID == "" {
-		log.Printf("GOOGLE_CLOUD_PROJECT env variable not set, cannot publish to PubSub")
-		log.Printf("Publish Message: %s", string(messageJSON))
-		return
+// parseInput parses the decoded message data, which is either a single InputPayload or a JSON array of them,
+// returning the individual requests and whether the message is a batch; URL lists stored in GCS are loaded
+func parseInput(ctx context.Context, data string) ([]InputPayload, bool, error) {
+	if strings.HasPrefix(strings.TrimSpace(data), "[") {
+		var inputs []InputPayload
+		if err := json.Unmarshal([]byte(data), &inputs); err != nil {
+			return nil, false, err
+		}
+		var requests []InputPayload
+		for _, input := range inputs {
+			if err := input.loadURLList(ctx); err != nil {
+				return nil, false, err
+			}
+			requests = append(requests, input.expand()...)
+		}
+		return requests, true, nil
 	}
 
-	ctx := context.Background()
-	client, err := pubsub.NewClient(ctx, projectID)
-	if err != nil {
-		log.Printf("Error creating PubSub client: %v", err)
-		log.Printf("Publish Message: %s", string(messageJSON))
-		return
+	var input InputPayload
+	if err := json.Unmarshal([]byte(data), &input); err != nil {
+		return nil, false, err
+	}
+	if err := input.loadURLList(ctx); err != nil {
+		return nil, false, err
 	}
+	return input.expand(), len(input.URLs) > 0 || len(input.Methods) > 0, nil
+}
 
-	topic := client.Topic(topicName)
-	result := topic.Publish(ctx, &pubsub.Message{
-		Data:       messageJSON,
-		Attributes: map[string]string{"type": "request"},
-	})
-	id, err := result.Get(ctx)
-	if err != nil {
-		log.Printf("Error publishing message to PubSub: %v", err)
-	} else {
-		log.Printf("Published message with ID: %s", id)
+// BatchInfo identifies an output's position within a message that requested multiple URLs
+type BatchInfo struct {
+	BatchID    string `json:"batchId"`
+	BatchIndex int    `json:"batchIndex"`
+	BatchSize  int    `json:"batchSize"`
+}
+
+// at returns a copy of the batch info for the item at index, or nil when the message was not a batch
+func (b *BatchInfo) at(index int) *BatchInfo {
+	if b == nil {
+		return nil
 	}
+	item := *b
+	item.BatchIndex = index
+	return &item
+}
+
+// OutputPayload represents the structure of the processed data
+type OutputPayload struct {
+	URL                     string                `json:"url"`
+	EffectiveURL            string                `json:"effectiveUrl,omitempty"`
+	Host                    string                `json:"host,omitempty"`
+	ServerName              string                `json:"serverName,omitempty"`
+	TLSVersion              string                `json:"tlsVersion,omitempty"`
+	CertChain               []CertInfo            `json:"certChain,omitempty"`
+	CertRevocationStatus    string                `json:"certRevocationStatus,omitempty"`
+	Error                   string                `json:"error,omitempty"`
+	Outcome                 string                `json:"outcome,omitempty"`
+	Headers                 string                `json:"headers,omitempty"`
+	HeadersTruncatedByCount bool                  `json:"headersTruncatedByCount,omitzero"`
+	Accept                  string                `json:"accept,omitempty"`
+	ContentType             string                `json:"contentType,omitempty"`
+	ContentTypeMismatch     bool                  `json:"contentTypeMismatch,omitzero"`
+	RawRequest              string                `json:"rawRequest,omitempty"`
+	RawResponseHead         string                `json:"rawResponseHead,omitempty"`
+	HeaderAssertions        []AssertionResult     `json:"headerAssertions,omitempty"`
+	BodyAssertions          []BodyAssertionResult `json:"bodyAssertions,omitempty"`
+	Trailers                map[string][]string   `json:"trailers,omitempty"`
+	ResponseBody            string                `json:"responseBody,omitempty"`
+	ResponseJson            string                `json:"responseJson,omitempty"`
+	ResponseXml             string                `json:"responseXml,omitempty"`
+	XmlValid                bool                  `json:"xmlValid,omitzero"`
+	BodyBytes               int                   `json:"bodyBytes,omitzero"`
+	BodyHash                string                `json:"bodyHash,omitempty"`
+	BodyIsUTF8              *bool                 `json:"bodyIsUtf8,omitempty"`
+	BodySkipped             bool                  `json:"bodySkipped,omitzero"`
+	BodySuppressedReason    string                `json:"bodySuppressedReason,omitempty"`
+	BodyRef                 string                `json:"bodyRef,omitempty"`
+	TransformError          string                `json:"transformError,omitempty"`
+	BodyDecoded             bool                  `json:"bodyDecoded,omitzero"`
+	BodyDecodeError         string                `json:"bodyDecodeError,omitempty"`
+	DecompressionTruncated  bool                  `json:"decompressionTruncated,omitzero"`
+	ResponseTime            int64                 `json:"responseTime,omitzero"` // in milliseconds
+	TTLB                    int64                 `json:"ttlb,omitzero"`         // in milliseconds
+	ServerTimings           []ServerTiming        `json:"serverTimings,omitempty"`
+	ThroughputKBps          float64               `json:"throughputKBps,omitzero"`
+	Slow                    bool                  `json:"slow,omitzero"`
+	RequestTime             string                `json:"requestTime"`
+	StatusCode              int                   `json:"statusCode,omitzero"`
+	RemoteAddr              string                `json:"remoteAddr,omitempty"`
+	ConnectionReused        bool                  `json:"connectionReused,omitzero"`
+	KeepAliveDisabled       bool                  `json:"keepAliveDisabled,omitzero"`
+	WebSocketProtocol       string                `json:"webSocketProtocol,omitempty"`
+	ConnectionIdleTime      int64                 `json:"connectionIdleTime,omitzero"` // in milliseconds
+	ResolvedIPs             []string              `json:"resolvedIPs,omitempty"`
+	DNSTime                 int64                 `json:"dnsTime,omitzero"` // in milliseconds
+	DNSRetries              int                   `json:"dnsRetries,omitzero"`
+	EarlyHints              []map[string]string   `json:"earlyHints,omitempty"`
+	Filename                string                `json:"filename,omitempty"`
+	BlockedRedirect         string                `json:"blockedRedirect,omitempty"`
+	HTTPSDowngrade          bool                  `json:"httpsDowngrade,omitzero"`
+	HTTPSDowngradeHops      []int                 `json:"httpsDowngradeHops,omitempty"`
+	RequestCompressed       bool                  `json:"requestCompressed,omitzero"`
+	Truncated               bool                  `json:"truncated,omitzero"`
+	ReadDeadlineHit         bool                  `json:"readDeadlineHit,omitzero"`
+	BodyReadTimedOut        bool                  `json:"bodyReadTimedOut,omitzero"`
+	ConnectionClosedEarly   bool                  `json:"connectionClosedEarly,omitzero"`
+	StatusChanged           bool                  `json:"statusChanged,omitzero"`
+	PreviousStatusCode      int                   `json:"previousStatusCode,omitzero"`
+	Unchanged               bool                  `json:"unchanged,omitzero"`
+	Samples                 *SampleStats          `json:"samples,omitempty"`
+	BodyClassification      string                `json:"bodyClassification,omitempty"`
+	UsedURL                 string                `json:"usedUrl,omitempty"`
+	BodyRetried             bool                  `json:"bodyRetried,omitzero"`
+	GroupID                 string                `json:"groupId,omitempty"`
+	Method                  string                `json:"method,omitempty"`
+	MetaRefreshHops         []string              `json:"metaRefreshHops,omitempty"`
+	AbortedOnTTFB           bool                  `json:"abortedOnTtfb,omitzero"`
+	Labels                  map[string]string     `json:"labels,omitempty"`
+	*BatchInfo
+
+	// metaRefresh is the meta refresh target of an HTML body, set only when FOLLOW_META_REFRESH is enabled
+	metaRefresh string
+
+	// bodyRetry is set when the raw body of a 2xx response contained RETRY_IF_BODY_CONTAINS
+	bodyRetry bool
+
+	// wireBody is the body as received, before decoding and TRANSFORM_SCRIPT, kept only for OUTPUT_FORMAT=warc
+	wireBody []byte
 }
 
 func main() {
@@ -99,9 +260,120 @@ func main() {
 		}
 	}
 
-	log.Printf("Starting HTTP Response Collector - Version: %s", Version)
+	// Set the commit from the VCS build info if not set by the build system
+	if Commit == "unknown" || Commit == "" {
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range bi.Settings {
+				if setting.Key == "vcs.revision" && setting.Value != "" {
+					Commit = setting.Value
+				}
+			}
+		}
+	}
+
+	log.Printf("Starting HTTP Response Collector - Version: %s, Commit: %s", Version, Commit)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	config = cfg
+
+	if config.BodyGCSBucket != "" {
+		if _, err := storageService(context.Background()); err != nil {
+			log.Fatalf("Failed to create GCS client: %v", err)
+		}
+	}
+
+	// Connect to the response topic once so every publish shares the client and its batching
+	responseTopic = newResponseTopic(context.Background())
+	if responseTopic != nil {
+		defer responseTopic.Stop()
+		sinks = append(sinks, pubsubSink{topic: responseTopic})
+	}
+
+	// Stream response metadata to BigQuery in analytics mode
+	if config.AnalyticsMode {
+		analyticsSink, err := newBigQuerySink(context.Background())
+		if err != nil {
+			log.Fatalf("Error connecting to BigQuery: %v", err)
+		}
+		sinks = append(sinks, analyticsSink)
+	}
+
+	// Produce to Kafka as well when configured, sharing one writer across every publish
+	if len(config.KafkaBrokers) > 0 {
+		kafkaProducer := newKafkaSink()
+		defer kafkaProducer.close()
+		sinks = append(sinks, kafkaProducer)
+	}
+
+	// Archive every published message as its own object when configured
+	if config.GCSArchiveBucket != "" {
+		archiveSink, err := newGCSArchiveSink(context.Background(), config.GCSArchiveBucket)
+		if err != nil {
+			log.Fatalf("Failed to create GCS client: %v", err)
+		}
+		sinks = append(sinks, archiveSink)
+	}
+
+	// Connect to the input topic failed batch items and large URL lists are re-published to
+	if config.InputTopic != "" {
+		inputTopic = newInputTopic(context.Background())
+		defer inputTopic.Stop()
+	}
+
+	// Compile the body transform script once so every fetch shares it
+	if config.TransformScript != "" {
+		transformFunc, err = loadTransform(config.TransformScriptName, config.TransformScript)
+		if err != nil {
+			log.Fatalf("Invalid transform script: %v", err)
+		}
+	}
+
+	// Parse the request body template once so a broken template fails at startup
+	if config.BodyTemplate != "" {
+		bodyTemplate, err = loadBodyTemplate(config.BodyTemplate)
+		if err != nil {
+			log.Fatalf("Invalid body template: %v", err)
+		}
+	}
+
+	if config.StatusCacheSize > 0 {
+		lastStatuses = newLRUCache[int](config.StatusCacheSize)
+	}
+	if config.DedupByHash != dedupOff && config.DedupCacheSize > 0 {
+		lastBodies = newLRUCache[string](config.DedupCacheSize)
+	}
+
+	if config.GlobalRPS > 0 {
+		globalLimiter = newRateLimiter(config.GlobalRPS)
+	}
+	for _, rule := range config.RateLimitRules {
+		ruleLimiters = append(ruleLimiters, newRateLimiter(rule.RPS))
+	}
+
+	if config.MaxHeapBytes > 0 {
+		go watchMemory(config.MaxHeapBytes)
+	}
+
+	// Build the shared transport from the loaded configuration and warm it up for frequently probed hosts
+	httpTransport = newTransport()
+	if len(config.WarmupHosts) > 0 {
+		warmUpHosts(config.WarmupHosts)
+	}
 
 	http.HandleFunc("/pubsub/push", pubSubHandler)
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/config", configHandler)
+	http.HandleFunc("/stats", statsHandler)
+	if config.EnableCollectBatch {
+		http.HandleFunc("/collect/batch", collectBatchHandler)
+	}
+	if config.RecentBufferSize > 0 {
+		recentOutputs = newRecentBuffer(config.RecentBufferSize)
+		http.HandleFunc("/recent", recentHandler)
+	}
 
 	port := ":8080"
 	log.Printf("Starting server on port %s", port)
@@ -110,21 +382,41 @@ func main() {
 	}
 }
 
+// isExpectedSubscription reports whether a message pushed by the subscription should be processed, matching
+// EXPECTED_SUBSCRIPTION against either the full projects/*/subscriptions/* name or the short subscription ID
+func isExpectedSubscription(subscription string) bool {
+	if config.ExpectedSubscription == "" {
+		return true
+	}
+	if subscription == config.ExpectedSubscription {
+		return true
+	}
+	_, id, found := strings.Cut(subscription, "/subscriptions/")
+	return found && id == config.ExpectedSubscription
+}
+
 // pubSubHandler handles incoming Pub/Sub push requests
 func pubSubHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		// Log the invalid method and return 200 OK to avoid retries
+		// Log the invalid method and acknowledge it to avoid retries
 		log.Printf("Invalid request method: %s", r.Method)
 		publishErrorMessage("Invalid request method", "")
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(handlerStatus(outcomeInvalidInput))
+		return
+	}
+
+	// Refuse the message before reading it while memory is high so Pub/Sub backs off and redelivers it later
+	if shedUnderMemoryPressure() {
+		log.Printf("Refusing message under memory pressure")
+		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("Error reading request body: %v", err)
-		publishErrorMessage("Cannot read body", "")
-		w.WriteHeader(http.StatusOK)
+		publishMessage(newErrorPayload("Cannot read body", "", resultConnectionError))
+		w.WriteHeader(handlerStatus(outcomeTransientError))
 		return
 	}
 	defer r.Body.Close()
@@ -133,61 +425,219 @@ func pubSubHandler(w http.ResponseWriter, r *http.Request) {
 	if err := json.Unmarshal(body, &msg); err != nil {
 		log.Printf("Error unmarshalling JSON: %v. Body: %s", err, string(body))
 		publishErrorMessage("Error unmarshalling JSON", string(body))
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(handlerStatus(outcomeInvalidInput))
 		return
 	}
 
-	// Decode the base64-encoded data
-	data, err := decodeBase64(msg.Message.Data)
-	if err != nil {
-		log.Printf("Error decoding data: %v. Data: %s", err, msg.Message.Data)
-		publishErrorMessage("Error decoding data", msg.Message.Data)
-		w.WriteHeader(http.StatusOK)
+	// Ignore messages pushed by a subscription other than the expected one, acknowledging them so they are not
+	// redelivered to a cross-wired endpoint
+	if !isExpectedSubscription(msg.Subscription) {
+		log.Printf("Warning: ignoring message %s from unexpected subscription %q", msg.Message.MessageID, msg.Subscription)
+		w.WriteHeader(handlerStatus(outcomeInvalidInput))
 		return
 	}
 
+	// Decode the data, which producers may send as plain JSON or base64-encoded and optionally gzipped, unless
+	// the URL is carried by the configured attribute
+	data, ok := attributeInput(msg.Message.Attributes)
+	if !ok {
+		data, err = decodeData(msg.Message.Data, msg.Message.Attributes)
+		if err != nil {
+			log.Printf("Error decoding data: %v. Data: %s", err, msg.Message.Data)
+			publishErrorMessage("Error decoding data", msg.Message.Data)
+			w.WriteHeader(handlerStatus(outcomeInvalidInput))
+			return
+		}
+	}
+
 	// Parse the input JSON payload
-	var input InputPayload
-	if err := json.Unmarshal([]byte(data), &input); err != nil {
+	requests, isBatch, err := parseInput(r.Context(), data)
+	var listErr *urlListError
+	if errors.As(err, &listErr) {
+		log.Printf("Error loading URL list: %v", err)
+		outcome, result := listErr.outcome(), resultConnectionError
+		if outcome == outcomeInvalidInput {
+			result = resultInvalidInput
+		}
+		publishMessage(newErrorPayload("Error reading URL list", listErr.uri, result))
+		w.WriteHeader(handlerStatus(outcome))
+		return
+	}
+	if err != nil {
 		log.Printf("Error unmarshalling input JSON: %v. Data: %s", err, data)
 		publishErrorMessage("Error unmarshalling input JSON", data)
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(handlerStatus(outcomeInvalidInput))
 		return
 	}
 
-	// Validate URL
-	if !isValidURL(input.URL) {
-		log.Printf("Invalid URL: %s", input.URL)
-		publishErrorMessage("Invalid URL", input.URL)
-		w.WriteHeader(http.StatusOK)
+	if len(requests) == 0 {
+		log.Printf("No URLs requested. Data: %s", data)
+		publishErrorMessage("No URLs requested", data)
+		w.WriteHeader(handlerStatus(outcomeInvalidInput))
 		return
 	}
 
-	// Fetch the URL and process the response
-	output, err := fetchURL(input.URL)
-	if err != nil {
-		log.Printf("Error fetching URL %s: %v", input.URL, err)
-		publishErrorMessage("Error fetching URL", input.URL)
-		w.WriteHeader(http.StatusOK)
+	if reason := batchSizeError(requests); reason != "" {
+		log.Printf("%s. Data: %s", reason, data)
+		publishErrorMessage(reason, data)
+		w.WriteHeader(handlerStatus(outcomeInvalidInput))
 		return
 	}
 
-	// Convert OutputPayload to JSON
-	outputJSON, err := json.Marshal(output)
-	if err != nil {
-		log.Printf("Error marshalling output JSON: %v", err)
-		publishErrorMessage("Error marshalling output JSON", input.URL)
-		w.WriteHeader(http.StatusOK)
+	// A URL list too long to collect within the ack deadline is split into messages that are each collected on
+	// their own, and the original is acknowledged once they are queued
+	if needsFanOut(requests) {
+		if inputTopic == nil {
+			reason := fmt.Sprintf("URL list of %d requests exceeds MAX_BATCH_SIZE of %d and INPUT_PUBSUB is not set to split it", len(requests), config.MaxBatchSize)
+			log.Printf("%s. Data: %s", reason, data)
+			publishErrorMessage(reason, data)
+			w.WriteHeader(handlerStatus(outcomeInvalidInput))
+			return
+		}
+		if err := publishRequests(r.Context(), requests, nil); err != nil {
+			log.Printf("Error splitting %d requests into %s, redelivering: %v", len(requests), config.InputTopic, err)
+			w.WriteHeader(handlerStatus(outcomeTransientError))
+			return
+		}
+		log.Printf("Split %d requests into messages of %d on %s", len(requests), config.MaxBatchSize, config.InputTopic)
+		w.WriteHeader(handlerStatus(outcomeSuccess))
 		return
 	}
 
-	// Log the output JSON to the console
-	log.Printf("Processed Response: %s", string(outputJSON))
+	for i := range requests {
+		requests[i].messageID = msg.Message.MessageID
+	}
+
+	// Collect each requested URL, stamping batch metadata when the message carried a list
+	var batch *BatchInfo
+	if isBatch {
+		batch = &BatchInfo{BatchID: uuid.NewString(), BatchSize: len(requests)}
+	}
+
+	outcomes := make([]handlerOutcome, len(requests))
+	for i, request := range requests {
+		_, outcomes[i] = collectAndPublish(r.Context(), request, batch.at(i))
+	}
+
+	attempt := republishAttempt(msg.Message.Attributes)
+	w.WriteHeader(handlerStatus(batchOutcome(r.Context(), requests, outcomes, attempt)))
+}
+
+// handlerOutcome classifies how the handling of a push request ended
+type handlerOutcome string
+
+const (
+	// outcomeSuccess means the URL was fetched and the result published
+	outcomeSuccess handlerOutcome = "success"
+	// outcomeInvalidInput means the request can never succeed and should not be redelivered
+	outcomeInvalidInput handlerOutcome = "invalid_input"
+	// outcomePermanentError means the fetch failed in a way redelivery will not fix, such as an unknown host
+	outcomePermanentError handlerOutcome = "permanent_error"
+	// outcomeTransientError means the request may succeed if Pub/Sub redelivers it
+	outcomeTransientError handlerOutcome = "transient_error"
+	// outcomeInternalError means the collector itself failed while handling the request
+	outcomeInternalError handlerOutcome = "internal_error"
+)
+
+// defaultHandlerStatus returns the default status codes, acking permanent failures and nacking transient ones
+func defaultHandlerStatus() map[handlerOutcome]int {
+	return map[handlerOutcome]int{
+		outcomeSuccess:        http.StatusOK,
+		outcomeInvalidInput:   http.StatusOK,
+		outcomePermanentError: http.StatusOK,
+		outcomeTransientError: http.StatusServiceUnavailable,
+		outcomeInternalError:  http.StatusInternalServerError,
+	}
+}
+
+// worseOutcome returns whichever outcome should decide the handler status, preferring redelivery over acknowledgement
+func worseOutcome(a, b handlerOutcome) handlerOutcome {
+	severity := map[handlerOutcome]int{
+		outcomeSuccess:        0,
+		outcomeInvalidInput:   1,
+		outcomePermanentError: 1,
+		outcomeInternalError:  2,
+		outcomeTransientError: 3,
+	}
+	if severity[b] > severity[a] {
+		return b
+	}
+	return a
+}
+
+// handlerStatus returns the HTTP status code the push handler responds with for an outcome
+func handlerStatus(outcome handlerOutcome) int {
+	if status, ok := config.HandlerStatus[outcome]; ok {
+		return status
+	}
+	return http.StatusOK
+}
 
-	// Optionally publish the processed message (currently just logs)
-	publishMessage(output)
+// attributeInput returns the input JSON for a message whose URL is carried by the URL_FROM_ATTRIBUTE attribute,
+// reporting false when the attribute is not configured or absent so the data is decoded instead
+func attributeInput(attributes map[string]string) (string, bool) {
+	if config.URLFromAttribute == "" {
+		return "", false
+	}
+	url := strings.TrimSpace(attributes[config.URLFromAttribute])
+	if url == "" {
+		return "", false
+	}
 
-	w.WriteHeader(http.StatusOK)
+	log.Printf("Message URL is in attribute %s, skipping data decoding", config.URLFromAttribute)
+	data, err := json.Marshal(InputPayload{URL: url})
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// maxInflatedDataBytes bounds the size of gzip-compressed message data once decompressed
+const maxInflatedDataBytes = 32 * 1024 * 1024
+
+// decodeData returns the message data as JSON, accepting data that is already a plain JSON object or array as
+// well as the base64 encoding Pub/Sub normally uses, gunzipping it when the message attributes declare a gzip
+// content encoding
+func decodeData(data string, attributes map[string]string) (string, error) {
+	// Base64 never starts with a brace or bracket, so valid JSON starting with one can't be mistaken for it
+	trimmed := strings.TrimSpace(data)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		log.Printf("Message data is plain JSON, skipping base64 decoding")
+		return trimmed, nil
+	}
+
+	log.Printf("Message data is base64 encoded")
+	decoded, err := decodeBase64(data)
+	if err != nil || !isGzipEncoded(attributes) {
+		return decoded, err
+	}
+
+	log.Printf("Message data is gzip compressed")
+	zr, err := gzip.NewReader(strings.NewReader(decoded))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	inflated := newTruncatingReader(zr, maxInflatedDataBytes)
+	raw, err := io.ReadAll(inflated)
+	if err != nil {
+		return "", err
+	}
+	if inflated.truncated {
+		return "", fmt.Errorf("decompressed data exceeds %d bytes", maxInflatedDataBytes)
+	}
+	return string(raw), nil
+}
+
+// isGzipEncoded reports whether the message attributes declare gzip-compressed data with a content-encoding
+// attribute, whatever its case
+func isGzipEncoded(attributes map[string]string) bool {
+	for name, value := range attributes {
+		if strings.EqualFold(name, "content-encoding") && strings.EqualFold(strings.TrimSpace(value), "gzip") {
+			return true
+		}
+	}
+	return false
 }
 
 // decodeBase64 decodes a base64-encoded string
@@ -199,32 +649,125 @@ func decodeBase64(encoded string) (string, error) {
 	return string(decodedBytes), nil
 }
 
-// fetchURL makes an HTTP GET request to the specified URL and processes the response
-func fetchURL(url string) (*OutputPayload, error) {
+// fetchURL makes the HTTP request described by the input and processes the response
+func fetchURL(ctx context.Context, input InputPayload) (*OutputPayload, error) {
+	transport := transportFor(input)
+	if transport != httpTransport {
+		// Per-request transports are never reused, so their connections are closed once the fetch is done
+		defer transport.CloseIdleConnections()
+	}
+
+	redirects := &redirectPolicy{}
 	client := &http.Client{
-		Timeout: 10 * time.Second, // Set a 10-second timeout
+		Transport:     transport,
+		Timeout:       10 * time.Second, // Set a 10-second timeout
+		CheckRedirect: redirects.checkRedirect,
+	}
+
+	// Spread simultaneous probes out before touching the network
+	if err := waitJitter(ctx); err != nil {
+		return nil, err
+	}
+	if err := waitRuleLimit(ctx, input.URL); err != nil {
+		return nil, fmt.Errorf("waiting for rate limit rule: %w", err)
+	}
+	if err := waitGlobalLimit(ctx); err != nil {
+		return nil, fmt.Errorf("waiting for global rate limit: %w", err)
+	}
+
+	body, compressed, err := requestBody(input)
+	if err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	// The request is cancelled with errBodyReadTimeout when the body takes longer than BODY_READ_TIMEOUT, or
+	// with errTTFBBudgetExceeded when the response is slower to start than TTFB_BUDGET_MS
+	reqCtx, cancelRequest := context.WithCancelCause(ctx)
+	defer cancelRequest(nil)
+
+	// Count the DNS retries made by the dials for this request
+	var dnsRetries atomic.Int32
+	reqCtx = withDNSRetryCounter(reqCtx, &dnsRetries)
+
+	req, err := http.NewRequestWithContext(reqCtx, input.method(), input.URL, body)
 	if err != nil {
 		return nil, err
 	}
 
+	applyDefaultQuery(req.URL)
+
 	// Set the User-Agent header
-	req.Header.Set("User-Agent", "http-response-collector")
+	req.Header.Set("User-Agent", userAgent())
+
+	// Link the request to the Pub/Sub message in the target's logs
+	if config.RequestIDHeader != "" && input.messageID != "" {
+		req.Header.Set(config.RequestIDHeader, input.messageID)
+	}
+
+	if input.ProbeWebSocket && req.Method == http.MethodGet {
+		setWebSocketUpgrade(req.Header)
+	}
+
+	// Apply the headers requested by the payload, which may override the defaults
+	for key, value := range input.Headers {
+		req.Header.Set(key, value)
+	}
+
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	// Go ignores a Host entry in the header map, so the override must be assigned to the request itself
+	if input.HostHeader != "" {
+		req.Host = input.HostHeader
+	}
+
+	// Sign the request last so the signature covers the final headers
+	if err := signRequest(ctx, req); err != nil {
+		return nil, fmt.Errorf("signing request: %w", err)
+	}
+
+	var rawRequest string
+	if config.CaptureRawRequest {
+		rawRequest = dumpRequest(req)
+	}
+
+	// Trace the connection so the address that actually served the response is recorded
+	trace := &fetchTrace{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
+	// Abandon the fetch as soon as the first response byte is overdue rather than waiting for the timeout
+	if config.TTFBBudget > 0 {
+		ttfbTimer := time.AfterFunc(config.TTFBBudget, func() { cancelRequest(errTTFBBudgetExceeded) })
+		defer ttfbTimer.Stop()
+		trace.firstByte = func() { ttfbTimer.Stop() }
+	}
 
 	startTime := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		if context.Cause(reqCtx) == errTTFBBudgetExceeded {
+			return nil, fmt.Errorf("%w: %w", errTTFBBudgetExceeded, err)
+		}
 		return nil, err
 	}
 	defer resp.Body.Close()
 	responseTime := time.Since(startTime).Milliseconds()
 
-	// Read the response headers
+	if config.BodyReadTimeout > 0 {
+		timer := time.AfterFunc(config.BodyReadTimeout, func() { cancelRequest(errBodyReadTimeout) })
+		defer timer.Stop()
+	}
+
+	// Read the response headers, keeping the first MAX_HEADERS in sorted order
 	headers := make(map[string]string)
-	for key, values := range resp.Header {
-		headers[key] = strings.Join(values, ", ")
+	headersTruncated := false
+	for _, key := range slices.Sorted(maps.Keys(resp.Header)) {
+		if config.MaxHeaders > 0 && len(headers) >= config.MaxHeaders {
+			headersTruncated = true
+			break
+		}
+		headers[key] = strings.Join(resp.Header[key], ", ")
 	}
 
 	// Encode headers as a JSON string
@@ -233,28 +776,416 @@ func fetchURL(url string) (*OutputPayload, error) {
 		encodedHeaders = []byte("{}")
 	}
 
-	// Read the response body with a limit of 10MB
-	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024)) // 10MB limit
-	if err != nil {
-		return nil, err
+	// Read the response body up to the size limit and deadline, streaming large bodies to GCS when configured
+	contentType := resp.Header.Get("Content-Type")
+	deadlineBody := &deadlineReader{ctx: reqCtx, r: resp.Body}
+	limitedBody := newTruncatingReader(deadlineBody, input.bodyLimit())
+	var bodyReader io.Reader = limitedBody
+
+	// Look for an in-band error in the raw body of 2xx responses as it is read, whatever happens to it afterwards
+	var retryMatcher *matchingReader
+	if config.RetryIfBodyContains != "" && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		retryMatcher = &matchingReader{r: limitedBody, pattern: []byte(config.RetryIfBodyContains)}
+		bodyReader = retryMatcher
 	}
+	bodyStartTime := time.Now()
+	var bodyBytes []byte
+	var stored *storedBody
+	var countedBytes int64
+	suppressedReason := bodySuppressedReason(contentType)
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		// The connection now speaks the upgraded protocol and has no body, so it is closed without reading
+		resp.Body.Close()
+	} else if config.CaptureBody {
+		if suppressedReason != "" {
+			// Bodies that must not be stored are only measured and hashed, never streamed to GCS
+			bodyBytes, err = io.ReadAll(bodyReader)
+		} else {
+			bodyBytes, stored, err = readOrStreamBody(ctx, bodyReader, contentType)
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if config.AnalyticsMode {
+		// Analytics only records the body size, so the body is counted without being buffered
+		countedBytes, err = io.Copy(io.Discard, bodyReader)
+		if err != nil {
+			return nil, err
+		}
+	} else if retryMatcher != nil {
+		// The body is not captured but must still be searched for RETRY_IF_BODY_CONTAINS
+		io.Copy(io.Discard, bodyReader)
+	} else {
+		drainBody(resp.Body)
+	}
+	bodyDownloadTime := time.Since(bodyStartTime)
+	timeToLastByte := time.Since(startTime).Milliseconds()
 
 	var output OutputPayload
-	output.URL = url
+	output.URL = input.URL
+	output.EffectiveURL = req.URL.String()
+	output.Host = cmp.Or(req.Host, req.URL.Host)
+	if resp.TLS != nil {
+		output.ServerName = resp.TLS.ServerName
+		output.TLSVersion = tls.VersionName(resp.TLS.Version)
+		output.CertChain = certChain(resp.TLS.PeerCertificates)
+		if config.CheckRevocation {
+			output.CertRevocationStatus = revocationStatus(ctx, resp.TLS)
+		}
+	}
+	output.RequestCompressed = compressed
+	output.KeepAliveDisabled = transport.DisableKeepAlives
+	output.Truncated = limitedBody.truncated
+	// The transport gunzips bodies it asked to be compressed, so the limit then applies to the decompressed bytes
+	output.DecompressionTruncated = resp.Uncompressed && limitedBody.truncated
+	output.BodyReadTimedOut = deadlineBody.deadlineHit && context.Cause(reqCtx) == errBodyReadTimeout
+	output.ReadDeadlineHit = deadlineBody.deadlineHit && !output.BodyReadTimedOut
+	output.ConnectionClosedEarly = deadlineBody.closedEarly
 	output.Headers = string(encodedHeaders)
+	output.HeadersTruncatedByCount = headersTruncated
+	output.RawRequest = rawRequest
+	if config.CaptureRawResponse {
+		output.RawResponseHead = dumpResponseHead(resp)
+	}
+	output.HeaderAssertions = assertHeaders(input.AssertHeaders, resp.Header)
+	if accept := req.Header.Get("Accept"); accept != "" {
+		output.Accept = accept
+		output.ContentType = contentType
+		output.ContentTypeMismatch = contentTypeMismatch(accept, contentType)
+	}
+	output.ServerTimings = parseServerTimings(resp.Header)
+	output.Trailers = collectTrailers(resp.Trailer)
+	output.RemoteAddr = trace.RemoteAddr()
+	reused, idleTime := trace.ConnectionReused()
+	output.ConnectionReused = reused
+	output.ConnectionIdleTime = idleTime.Milliseconds()
+	output.DNSRetries = int(dnsRetries.Load())
+	output.EarlyHints = trace.EarlyHints()
+	output.Filename = dispositionFilename(resp.Header.Get("Content-Disposition"))
+	output.BlockedRedirect = redirects.blockedTarget
+	output.HTTPSDowngrade = len(redirects.downgradeHops) > 0
+	output.HTTPSDowngradeHops = redirects.downgradeHops
 	output.ResponseTime = responseTime
+	output.TTLB = timeToLastByte
 	output.RequestTime = startTime.UTC().Format(time.RFC3339Nano)
 	output.StatusCode = resp.StatusCode
+	output.Outcome = statusResult(resp.StatusCode)
+	output.bodyRetry = retryMatcher != nil && retryMatcher.matched
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		output.WebSocketProtocol = resp.Header.Get("Sec-WebSocket-Protocol")
+	}
+
+	// Flag responses that exceeded the latency budget
+	if config.SlowThreshold > 0 && responseTime > config.SlowThreshold.Milliseconds() {
+		output.Slow = true
+		slowResponses.WithLabelValues(req.URL.Hostname()).Inc()
+	}
+
+	// Availability-only deployments record nothing derived from the body, and analytics only its size
+	if !config.CaptureBody {
+		if config.AnalyticsMode {
+			output.BodyBytes = int(countedBytes)
+		}
+		output.BodyAssertions = unevaluatedBodyAssertions(input.AssertBodyContains)
+		return &output, nil
+	}
+
+	// Measure the body download rate separately from the time to the response headers
+	bodySize := int64(len(bodyBytes))
+	if stored != nil {
+		bodySize = stored.size
+	}
+	output.ThroughputKBps = throughputKBps(bodySize, bodyDownloadTime)
+
+	// Bodies streamed to GCS are referenced rather than included
+	if stored != nil {
+		output.BodyBytes = int(stored.size)
+		output.BodyHash = stored.hash
+		output.BodyRef = stored.ref
+		output.BodyAssertions = unevaluatedBodyAssertions(input.AssertBodyContains)
+		return &output, nil
+	}
+
+	// WARC response records hold the body as received, with its original Content-Encoding
+	var wireBody []byte
+	if config.OutputFormat == outputFormatWARC {
+		wireBody = bodyBytes
+	}
+
+	// Decode compressed bodies the transport did not decode itself, keeping the raw bytes when that fails
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && len(bodyBytes) > 0 {
+		decoded, truncated, err := decodeBody(encoding, bodyBytes, input.bodyLimit())
+		if err != nil {
+			log.Printf("Error decoding %s body of %s: %v", encoding, input.URL, err)
+			output.BodyDecodeError = err.Error()
+		} else {
+			bodyBytes = decoded
+			output.BodyDecoded = true
+			output.Truncated = output.Truncated || truncated
+			output.DecompressionTruncated = truncated
+		}
+	}
+
+	if config.FollowMetaRefresh && isHTML(contentType) {
+		output.metaRefresh = metaRefreshTarget(resp.Request.URL, bodyBytes)
+	}
 
-	if json.Valid(bodyBytes) {
+	output.BodyBytes = len(bodyBytes)
+	output.BodyHash = hashBody(bodyBytes)
+	output.BodyIsUTF8 = new(utf8.Valid(bodyBytes))
+	output.BodyAssertions = assertBodyContains(input.AssertBodyContains, bodyBytes, input.AssertIgnoreCase)
+
+	// Only store the body for content types selected for capture and not denied
+	if suppressedReason != "" {
+		output.BodySkipped = true
+		output.BodySuppressedReason = suppressedReason
+		return &output, nil
+	}
+
+	output.wireBody = wireBody
+
+	// Apply the configured transform, keeping the original body if it fails
+	if transformFunc != nil {
+		transformed, err := transformBody(bodyBytes, resp.Header)
+		if err != nil {
+			log.Printf("Error transforming body of %s: %v", input.URL, err)
+			output.TransformError = err.Error()
+		} else {
+			bodyBytes = transformed
+		}
+	}
+
+	// Store the body as JSON or XML only when the content type and the body agree
+	output.BodyClassification = classifyBody(contentType, bodyBytes)
+	switch output.BodyClassification {
+	case classifiedJSONByContentType, classifiedJSONByContent:
 		output.ResponseJson = string(bodyBytes)
-	} else {
+		if config.RawBodyAlways {
+			output.ResponseBody = string(bodyBytes)
+		}
+	case classifiedXMLByContentType, classifiedXMLByContent:
+		output.ResponseXml = string(bodyBytes)
+		output.XmlValid = true
+		if config.RawBodyAlways {
+			output.ResponseBody = string(bodyBytes)
+		}
+	default:
 		output.ResponseBody = string(bodyBytes)
 	}
 
 	return &output, nil
 }
 
+// method returns the HTTP method requested by the payload, defaulting to GET
+func (p InputPayload) method() string {
+	if p.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(p.Method)
+}
+
+// bodyLimit returns the maximum number of response body bytes to read, honoring the payload's override
+// of MAX_BODY_BYTES up to the server-side hard maximum and the configured body prefix
+func (p InputPayload) bodyLimit() int64 {
+	limit := config.MaxBodyBytes
+	if p.MaxBodyBytes > 0 {
+		limit = int64(p.MaxBodyBytes)
+	}
+	if config.BodyPrefixBytes > 0 {
+		limit = min(limit, config.BodyPrefixBytes)
+	}
+	return min(limit, config.MaxBodyBytesHardLimit)
+}
+
+// requestBody returns a reader for the request body, or nil when there is none, rendering BODY_TEMPLATE for
+// payloads without a body and gzipping the body when the payload asks for compression and reporting whether it did
+func requestBody(input InputPayload) (io.Reader, bool, error) {
+	payload, err := templatedBody(input)
+	if err != nil {
+		return nil, false, fmt.Errorf("rendering body template: %w", err)
+	}
+	if payload == "" {
+		return nil, false, nil
+	}
+	if !input.CompressRequest {
+		return strings.NewReader(payload), false, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(payload)); err != nil {
+		return nil, false, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, false, err
+	}
+	return &buf, true, nil
+}
+
+// applyDefaultQuery adds the configured default query parameters that the URL does not already set
+func applyDefaultQuery(u *neturl.URL) {
+	if len(config.DefaultQuery) == 0 {
+		return
+	}
+
+	query := u.Query()
+	added := false
+	for key, values := range config.DefaultQuery {
+		if !query.Has(key) {
+			query[key] = values
+			added = true
+		}
+	}
+	if added {
+		u.RawQuery = query.Encode()
+	}
+}
+
+// waitJitter sleeps for a random delay of up to the configured fetch jitter, returning early if the context ends
+func waitJitter(ctx context.Context) error {
+	if config.FetchJitter <= 0 {
+		return nil
+	}
+
+	return sleepContext(ctx, rand.N(config.FetchJitter+1))
+}
+
+// hashBody returns the hex-encoded SHA-256 hash of the response body
+func hashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// matchesContentType reports whether the media type of contentType matches one of the patterns,
+// which may be exact types like "application/json" or wildcards like "text/*"; an empty pattern list matches everything
+func matchesContentType(contentType string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Reasons a body was not stored because of its content type
+const (
+	suppressedDenied     = "content_type_denied"
+	suppressedNotAllowed = "content_type_not_allowed"
+)
+
+// bodySuppressedReason returns why a body of the content type must not be stored, or "" when it may be; the
+// deny list takes precedence over the allow list
+func bodySuppressedReason(contentType string) string {
+	if len(config.NoStoreContentTypes) > 0 && matchesContentType(contentType, config.NoStoreContentTypes) {
+		return suppressedDenied
+	}
+	if !matchesContentType(contentType, config.CaptureContentTypes) {
+		return suppressedNotAllowed
+	}
+	return ""
+}
+
+// dispositionFilename returns the suggested filename from a Content-Disposition header; mime.ParseMediaType
+// decodes the RFC 5987 "filename*" form into the same "filename" parameter, preferring it over the plain form
+func dispositionFilename(disposition string) string {
+	if disposition == "" {
+		return ""
+	}
+
+	_, params, err := mime.ParseMediaType(disposition)
+	if err != nil {
+		return ""
+	}
+	return params["filename"]
+}
+
+// collectTrailers returns the trailers announced by the response, which are only populated once the body has been fully read
+func collectTrailers(trailer http.Header) map[string][]string {
+	trailers := make(map[string][]string)
+	for key, values := range trailer {
+		if len(values) > 0 {
+			trailers[key] = values
+		}
+	}
+	if len(trailers) == 0 {
+		return nil
+	}
+	return trailers
+}
+
+// userAgent builds the User-Agent header identifying the collector build, with the optional configured suffix
+func userAgent() string {
+	ua := fmt.Sprintf("http-response-collector/%s (%s)", Version, Commit)
+	if config.UserAgentSuffix != "" {
+		ua += " " + config.UserAgentSuffix
+	}
+	return ua
+}
+
+// isAllowedPort reports whether the URL targets a port permitted by ALLOWED_PORTS, using the scheme's
+// default port when the URL has none; every port is allowed when no allowlist is configured
+func isAllowedPort(rawURL string) bool {
+	if len(config.AllowedPorts) == 0 {
+		return true
+	}
+
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil {
+		return allowlistUndetermined(rawURL, err)
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = "80"
+		if parsed.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	number, err := strconv.Atoi(port)
+	if err != nil {
+		return allowlistUndetermined(rawURL, err)
+	}
+	return slices.Contains(config.AllowedPorts, number)
+}
+
+// allowlistUndetermined decides a URL the allowlist could not evaluate according to ALLOWLIST_FAIL_MODE,
+// logging the decision
+func allowlistUndetermined(rawURL string, err error) bool {
+	allowed := config.AllowlistFailMode == allowlistFailOpen
+	log.Printf("Allowlist could not evaluate %s (%v), failing %s: allowed=%t", rawURL, err, config.AllowlistFailMode, allowed)
+	return allowed
+}
+
+// Behaviors when the allowlist cannot evaluate a URL
+const (
+	allowlistFailOpen   = "open"
+	allowlistFailClosed = "closed"
+)
+
+// isValidMethod reports whether the method is a plausible HTTP method token
+func isValidMethod(method string) bool {
+	for _, c := range method {
+		if (c < 'A' || c > 'Z') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return method != ""
+}
+
 // isValidURL performs a basic validation of the URL format
 func isValidURL(url string) bool {
 	// Basic check to see if the URL starts with http or https
@@ -263,10 +1194,15 @@ func isValidURL(url string) bool {
 
 // publishErrorMessage logs an error message variant
 func publishErrorMessage(errorMsg string, url string) {
-	errorPayload := OutputPayload{
+	publishMessage(newErrorPayload(errorMsg, url, resultInvalidInput))
+}
+
+// newErrorPayload builds the output published when a URL could not be collected
+func newErrorPayload(errorMsg string, url string, outcome string) *OutputPayload {
+	return &OutputPayload{
 		URL:         url,
 		Error:       errorMsg,
+		Outcome:     outcome,
 		RequestTime: time.Now().UTC().Format(time.RFC3339Nano),
 	}
-	publishMessage(errorPayload)
 }
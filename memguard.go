@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// memoryCheckInterval is how often the heap is measured against MAX_HEAP_BYTES; ReadMemStats briefly stops the
+// world, so it is not measured per request
+const memoryCheckInterval = 5 * time.Second
+
+// memoryPressure is set while the heap exceeds MAX_HEAP_BYTES, shedding new work until it recovers
+var memoryPressure atomic.Bool
+
+// watchMemory measures the heap every memoryCheckInterval, flagging memory pressure while it exceeds the limit
+func watchMemory(limit int64) {
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+
+	var stats runtime.MemStats
+	for range ticker.C {
+		runtime.ReadMemStats(&stats)
+		heapBytes.Set(float64(stats.HeapAlloc))
+
+		over := stats.HeapAlloc > uint64(limit)
+		if over != memoryPressure.Swap(over) {
+			if over {
+				log.Printf("Heap of %d bytes exceeds MAX_HEAP_BYTES of %d, shedding new requests", stats.HeapAlloc, limit)
+			} else {
+				log.Printf("Heap of %d bytes is back under MAX_HEAP_BYTES of %d, accepting requests", stats.HeapAlloc, limit)
+			}
+		}
+	}
+}
+
+// shedUnderMemoryPressure reports whether a request must be refused because the heap is over MAX_HEAP_BYTES,
+// counting it when so
+func shedUnderMemoryPressure() bool {
+	if !memoryPressure.Load() {
+		return false
+	}
+	shedRequests.Inc()
+	return true
+}
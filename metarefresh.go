@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"log"
+	"mime"
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+// metaRefreshPattern matches a <meta http-equiv="refresh" content="..."> tag with the attributes in either order
+var metaRefreshPattern = regexp.MustCompile(`(?is)<meta\s[^>]*?(?:http-equiv\s*=\s*["']?refresh["']?[^>]*?content\s*=\s*(?:"([^"]*)"|'([^']*)')|content\s*=\s*(?:"([^"]*)"|'([^']*)')[^>]*?http-equiv\s*=\s*["']?refresh["']?)`)
+
+// isHTML reports whether the content type is an HTML document
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// metaRefreshTarget returns the absolute URL an HTML body redirects to with a meta refresh, resolved against
+// the URL the body was served from, or "" when it has none; a refresh without a URL only reloads the page
+func metaRefreshTarget(base *neturl.URL, body []byte) string {
+	match := metaRefreshPattern.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+
+	var content string
+	for _, group := range match[1:] {
+		if len(group) > 0 {
+			content = string(group)
+			break
+		}
+	}
+
+	// The content is a delay optionally followed by the URL, e.g. "0; url=https://example.com/"
+	_, target, found := strings.Cut(content, ";")
+	if !found {
+		_, target, found = strings.Cut(content, ",")
+	}
+	target = strings.TrimSpace(target)
+	if len(target) >= 4 && strings.EqualFold(target[:4], "url=") {
+		target = strings.TrimSpace(target[4:])
+	}
+	target = strings.Trim(target, `"'`)
+	if !found || target == "" {
+		return ""
+	}
+
+	resolved, err := base.Parse(target)
+	if err != nil {
+		return ""
+	}
+	return resolved.String()
+}
+
+// fetchFollowingMetaRefresh fetches the URL and, when FOLLOW_META_REFRESH is enabled, follows meta refresh
+// redirects of HTML responses with GET requests up to the redirect limit, publishing the landing page under the
+// requested URL
+func fetchFollowingMetaRefresh(ctx context.Context, input InputPayload) (*OutputPayload, error) {
+	output, err := fetchURL(ctx, input)
+	if !config.FollowMetaRefresh {
+		return output, err
+	}
+
+	var hops []string
+	current := input
+	for err == nil && output.metaRefresh != "" {
+		target := output.metaRefresh
+		if target == current.URL || len(hops) >= maxRedirects {
+			break
+		}
+
+		// Meta refresh targets get the same checks as requested URLs and HTTP redirects
+		if !isValidURL(target) || !isAllowedPort(target) {
+			log.Printf("Not following invalid meta refresh from %s to %s", current.URL, target)
+			output.BlockedRedirect = target
+			break
+		}
+		if config.SameHostRedirectsOnly && !sameHost(input.URL, target) {
+			log.Printf("Not following cross-host meta refresh from %s to %s", input.URL, target)
+			output.BlockedRedirect = target
+			break
+		}
+
+		// Like HTTP redirects, a hop to another host does not carry the overrides and headers meant for the first
+		if !sameHost(current.URL, target) {
+			current.HostHeader = ""
+			current.ServerName = ""
+			current.Headers = nil
+		}
+
+		hops = append(hops, target)
+		current.URL = target
+		current.Method = ""
+		current.Body = ""
+		current.CompressRequest = false
+		output, err = fetchURL(ctx, current)
+	}
+
+	if err == nil && len(hops) > 0 {
+		output.URL = input.URL
+		output.MetaRefreshHops = hops
+	}
+	return output, err
+}
+
+// sameHost reports whether two URLs have the same host and port
+func sameHost(a, b string) bool {
+	first, err := neturl.Parse(a)
+	if err != nil {
+		return false
+	}
+	second, err := neturl.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(first.Host, second.Host)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// slowResponses counts responses that exceeded the configured slow threshold
+var slowResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_response_collector_slow_responses_total",
+	Help: "Number of responses whose response time exceeded SLOW_THRESHOLD_MS.",
+}, []string{"host"})
+
+// rateLimitWaits records how long fetches waited for the global rate limit
+var rateLimitWaits = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "http_response_collector_rate_limit_wait_seconds",
+	Help:    "Time fetches waited for the GLOBAL_RPS rate limit.",
+	Buckets: []float64{0, .01, .05, .1, .5, 1, 5, 10, 30},
+})
+
+// rateLimitRuleWaits records how long fetches waited for the RATE_LIMIT_RULES entry matching their URL
+var rateLimitRuleWaits = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_response_collector_rate_limit_rule_wait_seconds",
+	Help:    "Time fetches waited for the RATE_LIMIT_RULES entry matching their URL.",
+	Buckets: []float64{0, .01, .05, .1, .5, 1, 5, 10, 30},
+}, []string{"rule"})
+
+// publishLatency records how long the sink took to confirm each published message
+var publishLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_response_collector_publish_latency_seconds",
+	Help:    "Time from publishing a message until the sink (Pub/Sub, Kafka, BigQuery or GCS archive) confirmed or rejected it.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"topic", "outcome"})
+
+// publishSize records the size of each published message
+var publishSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_response_collector_publish_message_bytes",
+	Help:    "Size in bytes of each published message.",
+	Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+}, []string{"topic", "outcome"})
+
+// heapBytes reports the heap size last measured by the MAX_HEAP_BYTES memory guard
+var heapBytes = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "http_response_collector_heap_bytes",
+	Help: "Heap bytes allocated as last measured by the MAX_HEAP_BYTES memory guard.",
+})
+
+// shedRequests counts requests refused while the heap exceeded MAX_HEAP_BYTES
+var shedRequests = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "http_response_collector_shed_requests_total",
+	Help: "Number of requests refused with 503 while the heap exceeded MAX_HEAP_BYTES.",
+})
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// acceptedMediaRanges returns the media ranges of an Accept header, dropping those refused with q=0
+func acceptedMediaRanges(accept string) []string {
+	var ranges []string
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			mediaRange, _, _ = strings.Cut(part, ";")
+			mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+		}
+		if mediaRange == "" {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q <= 0 {
+			continue
+		}
+		ranges = append(ranges, mediaRange)
+	}
+	return ranges
+}
+
+// contentTypeMismatch reports whether the response content type falls outside every media range the request
+// accepted; a missing content type or an Accept header allowing anything never conflicts
+func contentTypeMismatch(accept string, contentType string) bool {
+	ranges := acceptedMediaRanges(accept)
+	if len(ranges) == 0 || strings.TrimSpace(contentType) == "" || slices.Contains(ranges, "*/*") {
+		return false
+	}
+	return !matchesContentType(contentType, ranges)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Values of the CertRevocationStatus field
+const (
+	revocationGood      = "good"
+	revocationRevoked   = "revoked"
+	revocationUnknown   = "unknown"
+	revocationUnchecked = "unchecked"
+)
+
+// ocspTimeout bounds the OCSP query so a slow responder cannot stall the fetch for long
+const ocspTimeout = 5 * time.Second
+
+// maxOCSPResponseBytes bounds the OCSP response read from the responder
+const maxOCSPResponseBytes = 64 * 1024
+
+// revocationStatus returns the OCSP status of the leaf certificate of a TLS connection, preferring a response
+// stapled to the handshake over querying the responder named in the certificate
+func revocationStatus(ctx context.Context, state *tls.ConnectionState) string {
+	if len(state.PeerCertificates) == 0 {
+		return revocationUnchecked
+	}
+	leaf := state.PeerCertificates[0]
+
+	// The issuer is needed to build and verify the request; fall back to the verified chain when the server
+	// only sent the leaf
+	var issuer *x509.Certificate
+	if len(state.PeerCertificates) > 1 {
+		issuer = state.PeerCertificates[1]
+	} else if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 1 {
+		issuer = state.VerifiedChains[0][1]
+	}
+	if issuer == nil {
+		return revocationUnchecked
+	}
+
+	raw := state.OCSPResponse
+	if len(raw) == 0 {
+		if len(leaf.OCSPServer) == 0 {
+			return revocationUnchecked
+		}
+		var err error
+		raw, err = queryOCSP(ctx, leaf.OCSPServer[0], leaf, issuer)
+		if err != nil {
+			log.Printf("Error querying OCSP responder %s: %v", leaf.OCSPServer[0], err)
+			return revocationUnchecked
+		}
+	}
+
+	response, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		log.Printf("Error parsing OCSP response for %s: %v", leaf.Subject, err)
+		return revocationUnchecked
+	}
+	switch response.Status {
+	case ocsp.Good:
+		return revocationGood
+	case ocsp.Revoked:
+		return revocationRevoked
+	default:
+		return revocationUnknown
+	}
+}
+
+// queryOCSP sends an OCSP request for the certificate to the responder and returns the raw response
+func queryOCSP(ctx context.Context, responder string, cert, issuer *x509.Certificate) ([]byte, error) {
+	// The responder comes from the fetched certificate, so it gets the same checks as requested URLs
+	if !isValidURL(responder) || !isAllowedPort(responder) {
+		return nil, fmt.Errorf("responder %s is not an allowed URL", responder)
+	}
+
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ocspTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responder, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("User-Agent", userAgent())
+
+	resp, err := httpTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("responder returned status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseBytes))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Values of the Outcome field summarizing what happened when collecting a URL
+const (
+	resultSuccess         = "success"
+	resultHTTP4xx         = "http_4xx"
+	resultHTTP5xx         = "http_5xx"
+	resultTimeout         = "timeout"
+	resultDNSError        = "dns_error"
+	resultConnectionError = "connection_error"
+	resultTLSError        = "tls_error"
+	resultInvalidInput    = "invalid_input"
+	resultInternalError   = "internal_error"
+)
+
+// statusResult returns the outcome of a request that received a response with the given status code
+func statusResult(statusCode int) string {
+	switch {
+	case statusCode >= http.StatusInternalServerError:
+		return resultHTTP5xx
+	case statusCode >= http.StatusBadRequest:
+		return resultHTTP4xx
+	default:
+		return resultSuccess
+	}
+}
+
+// fetchErrorOutcome returns the handler outcome of a failed fetch: a host that does not exist or a TLS failure
+// such as an untrusted certificate will fail the same way when redelivered, and a fetch abandoned on
+// TTFB_BUDGET_MS was given up on deliberately, so they are acknowledged, while timeouts, connection errors and
+// temporary DNS failures are redelivered
+func fetchErrorOutcome(err error) handlerOutcome {
+	if errors.Is(err, errTTFBBudgetExceeded) {
+		return outcomePermanentError
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return outcomePermanentError
+		}
+		return outcomeTransientError
+	}
+	if errorResult(err) == resultTLSError {
+		return outcomePermanentError
+	}
+	return outcomeTransientError
+}
+
+// errorResult returns the outcome of a request that failed before a response was received
+func errorResult(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return resultDNSError
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errTTFBBudgetExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return resultTimeout
+	}
+
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return resultTLSError
+	}
+
+	return resultConnectionError
+}
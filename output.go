@@ -0,0 +1,130 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Formats of published messages
+const (
+	outputFormatRaw         = "raw"
+	outputFormatCloudEvents = "cloudevents"
+	outputFormatWARC        = "warc"
+)
+
+// cloudEvent is a CloudEvents 1.0 envelope in structured JSON mode
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// encodeMessage serializes an output into the published message data and attributes for the configured
+// OUTPUT_FORMAT
+func encodeMessage(output *OutputPayload) ([]byte, map[string]string, error) {
+	data, err := encodeOutput(output)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attributes := messageAttributes(output)
+	if config.OutputFormat == outputFormatWARC {
+		attributes["content-type"] = "application/warc"
+		return encodeWARC(output, data), attributes, nil
+	}
+	if config.OutputFormat != outputFormatCloudEvents {
+		return data, attributes, nil
+	}
+
+	// The structured content mode of the CloudEvents Pub/Sub binding carries the whole event as the data
+	event, err := json.Marshal(cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              uuid.NewString(),
+		Source:          config.CloudEventsSource,
+		Type:            config.CloudEventsType,
+		Subject:         output.URL,
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType: "application/json",
+		Data:            data,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	attributes["content-type"] = "application/cloudevents+json"
+	return event, attributes, nil
+}
+
+// alwaysOutputFields are kept in every published payload even when OUTPUT_FIELDS leaves them out
+var alwaysOutputFields = []string{"url", "statusCode"}
+
+// encodeOutput serializes an output for publishing, keeping only the fields selected by OUTPUT_FIELDS and
+// renaming them as configured by OUTPUT_FIELD_MAP
+func encodeOutput(output *OutputPayload) ([]byte, error) {
+	encoded, err := json.Marshal(output)
+	if err != nil || (len(config.OutputFields) == 0 && len(config.OutputFieldMap) == 0) {
+		return encoded, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+
+	selected := fields
+	if len(config.OutputFields) > 0 {
+		selected = make(map[string]json.RawMessage, len(config.OutputFields)+len(alwaysOutputFields))
+		for _, name := range slices.Concat(alwaysOutputFields, config.OutputFields) {
+			if value, ok := fields[name]; ok {
+				selected[name] = value
+			}
+		}
+	}
+
+	renamed := make(map[string]json.RawMessage, len(selected))
+	for name, value := range selected {
+		renamed[cmp.Or(config.OutputFieldMap[name], name)] = value
+	}
+	return json.Marshal(renamed)
+}
+
+// outputFieldNames returns the JSON names of every field an output can contain, including embedded structs
+func outputFieldNames() []string {
+	return jsonFieldNames(reflect.TypeFor[OutputPayload]())
+}
+
+// jsonFieldNames lists the JSON names of the struct's exported fields, flattening embedded structs
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			names = append(names, jsonFieldNames(embedded)...)
+			continue
+		}
+		if name == "-" {
+			continue
+		}
+		names = append(names, cmp.Or(name, field.Name))
+	}
+	return names
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Actions taken when the response topic is unavailable at startup
+const (
+	pubsubFailFatal    = "fatal"
+	pubsubFailLog      = "log"
+	pubsubFailFallback = "fallback"
+)
+
+// responseTopic is the shared topic responses are published to, or nil when they are only logged
+var responseTopic *pubsub.Topic
+
+// newResponseTopic connects to the RESPONSE_PUBSUB topic with the configured publish batching settings,
+// returning nil when responses should only be logged
+func newResponseTopic(ctx context.Context) *pubsub.Topic {
+	if config.ResponseTopic == "" {
+		return nil
+	}
+
+	if config.ProjectID == "" {
+		return unavailableResponseTopic(ctx, nil, fmt.Errorf("GOOGLE_CLOUD_PROJECT env variable not set"))
+	}
+
+	client, err := pubsub.NewClient(ctx, config.ProjectID)
+	if err != nil {
+		return unavailableResponseTopic(ctx, nil, fmt.Errorf("creating PubSub client: %w", err))
+	}
+
+	// Verify the topic is usable so a missing topic or permission is caught at startup rather than per message
+	topic := client.Topic(config.ResponseTopic)
+	if err := verifyTopic(ctx, topic); errors.Is(err, errTopicUnavailable) {
+		if topic = unavailableResponseTopic(ctx, client, err); topic == nil {
+			return nil
+		}
+	} else if err != nil {
+		// A check that could not complete says nothing about the topic, so it is kept and publish errors are
+		// reported per message
+		log.Printf("WARNING: Could not verify response topic, publishing to it anyway: %v", err)
+	}
+
+	// Settings left at zero keep the library defaults
+	if config.PublishDelayThreshold > 0 {
+		topic.PublishSettings.DelayThreshold = config.PublishDelayThreshold
+	}
+	if config.PublishCountThreshold > 0 {
+		topic.PublishSettings.CountThreshold = config.PublishCountThreshold
+	}
+	if config.PublishByteThreshold > 0 {
+		topic.PublishSettings.ByteThreshold = config.PublishByteThreshold
+	}
+	return topic
+}
+
+// unavailableResponseTopic applies ON_PUBSUB_FAIL once the response topic cannot be used, returning the topic to
+// publish to instead or nil when responses should only be logged; client is nil when none could be created
+func unavailableResponseTopic(ctx context.Context, client *pubsub.Client, err error) *pubsub.Topic {
+	switch config.OnPubSubFail {
+	case pubsubFailFatal:
+		log.Fatalf("Response topic unavailable: %v", err)
+	case pubsubFailFallback:
+		if client == nil {
+			log.Printf("WARNING: Response topic unavailable and %s cannot be reached without a client, responses will only be logged: %v", config.FallbackTopic, err)
+			return nil
+		}
+		log.Printf("Response topic unavailable, falling back to %s: %v", config.FallbackTopic, err)
+		topic := client.Topic(config.FallbackTopic)
+		if err := verifyTopic(ctx, topic); errors.Is(err, errTopicUnavailable) {
+			log.Printf("WARNING: Fallback topic unavailable, responses will only be logged: %v", err)
+			return nil
+		} else if err != nil {
+			log.Printf("WARNING: Could not verify fallback topic, publishing to it anyway: %v", err)
+		}
+		return topic
+	}
+	log.Printf("WARNING: Response topic unavailable, responses will only be logged: %v", err)
+	return nil
+}
+
+// errTopicUnavailable marks a verification failure showing the topic cannot be published to, as opposed to a
+// check that could not complete and may pass later
+var errTopicUnavailable = errors.New("topic unavailable")
+
+// verifyTopic checks that the topic exists and that the collector may publish to it, wrapping errTopicUnavailable
+// when it definitely cannot; a failed existence check is tolerated because the publisher role alone does not
+// grant pubsub.topics.get
+func verifyTopic(ctx context.Context, topic *pubsub.Topic) error {
+	exists, err := topic.Exists(ctx)
+	if err == nil && !exists {
+		return fmt.Errorf("%w: %s does not exist", errTopicUnavailable, topic.ID())
+	}
+
+	granted, err := topic.IAM().TestPermissions(ctx, []string{"pubsub.topics.publish"})
+	if code := status.Code(err); code == codes.NotFound || code == codes.PermissionDenied {
+		return fmt.Errorf("%w: checking publish permission on %s: %v", errTopicUnavailable, topic.ID(), err)
+	}
+	if err != nil {
+		return fmt.Errorf("checking publish permission on topic %s: %w", topic.ID(), err)
+	}
+	if !slices.Contains(granted, "pubsub.topics.publish") {
+		return fmt.Errorf("%w: missing pubsub.topics.publish permission on %s", errTopicUnavailable, topic.ID())
+	}
+	return nil
+}
+
+// messageAttributes returns the Pub/Sub attributes subscribers can filter on without decoding the payload;
+// the status attributes are omitted for payloads without a response
+func messageAttributes(output *OutputPayload) map[string]string {
+	attributes := map[string]string{"type": "request"}
+	if output.StatusCode > 0 {
+		attributes["statusCode"] = strconv.Itoa(output.StatusCode)
+		attributes["statusClass"] = fmt.Sprintf("%dxx", output.StatusCode/100)
+	}
+	if output.Unchanged {
+		attributes["unchanged"] = "true"
+	}
+	return attributes
+}
+
+// sink is a destination published messages are delivered to
+type sink interface {
+	// name identifies the destination in logs and metrics
+	name() string
+
+	// send delivers the message and calls done with its ID, if the destination assigns one, once the destination
+	// accepted or rejected it; destinations that batch messages call done from another goroutine after returning
+	send(ctx context.Context, output *OutputPayload, data []byte, attributes map[string]string, done func(id string, err error))
+}
+
+// sinks are the destinations every published message is delivered to; messages are only logged when empty
+var sinks []sink
+
+// pubsubSink publishes messages to a Pub/Sub topic
+type pubsubSink struct {
+	topic *pubsub.Topic
+}
+
+// name implements sink
+func (p pubsubSink) name() string {
+	return p.topic.ID()
+}
+
+// send implements sink, handing the message to the topic's batching publisher and waiting for the result in a
+// goroutine, so consecutive messages are batched under the PUBLISH_*_THRESHOLD settings instead of each waiting
+// for its own round trip
+func (p pubsubSink) send(ctx context.Context, output *OutputPayload, data []byte, attributes map[string]string, done func(id string, err error)) {
+	result := p.topic.Publish(ctx, &pubsub.Message{
+		Data:       data,
+		Attributes: attributes,
+	})
+	go func() {
+		done(result.Get(ctx))
+	}()
+}
+
+// publishMessage publishes the output to every sink, or logs it when there is none, stamping the deployment
+// labels on every output including error payloads
+func publishMessage(output *OutputPayload) {
+	if len(config.OutputLabels) > 0 {
+		labels := maps.Clone(output.Labels)
+		if labels == nil {
+			labels = make(map[string]string, len(config.OutputLabels))
+		}
+		maps.Copy(labels, config.OutputLabels)
+		output.Labels = labels
+	}
+
+	messageJSON, attributes, err := encodeMessage(output)
+	if err != nil {
+		log.Printf("Error marshalling message for publishing: %v", err)
+		return
+	}
+
+	if len(sinks) == 0 {
+		log.Printf("Publish Message: %s", string(messageJSON))
+		return
+	}
+
+	ctx := context.Background()
+	for _, s := range sinks {
+		startTime := time.Now()
+		s.send(ctx, output, messageJSON, attributes, func(id string, err error) {
+			publishOutcome := "success"
+			if err != nil {
+				publishOutcome = "error"
+				log.Printf("Error publishing message to %s: %v", s.name(), err)
+			} else if id != "" {
+				log.Printf("Published message with ID: %s", id)
+			} else {
+				log.Printf("Published message to %s", s.name())
+			}
+			publishLatency.WithLabelValues(s.name(), publishOutcome).Observe(time.Since(startTime).Seconds())
+			publishSize.WithLabelValues(s.name(), publishOutcome).Observe(float64(len(messageJSON)))
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"math"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// globalLimiter caps the rate of outbound requests across the whole instance, or is nil when unlimited
+var globalLimiter *rate.Limiter
+
+// newRateLimiter returns a limiter admitting rps requests per second, allowing a burst of one second's worth
+func newRateLimiter(rps float64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(rps), max(1, int(math.Ceil(rps))))
+}
+
+// waitGlobalLimit blocks until the global rate limit admits another request, failing early when the wait
+// would outlast the context deadline
+func waitGlobalLimit(ctx context.Context) error {
+	if globalLimiter == nil {
+		return nil
+	}
+
+	startTime := time.Now()
+	err := globalLimiter.Wait(ctx)
+	rateLimitWaits.Observe(time.Since(startTime).Seconds())
+	return err
+}
+
+// RateLimitRule caps the rate of requests to URLs whose host and path start with the given prefixes
+type RateLimitRule struct {
+	HostPrefix string  `json:"hostPrefix"`
+	PathPrefix string  `json:"pathPrefix"`
+	RPS        float64 `json:"rps"`
+}
+
+// matches reports whether the rule covers the URL; an empty prefix matches anything
+func (r RateLimitRule) matches(u *neturl.URL) bool {
+	return strings.HasPrefix(u.Hostname(), r.HostPrefix) && strings.HasPrefix(u.EscapedPath(), r.PathPrefix)
+}
+
+// ruleLimiters holds one limiter per RATE_LIMIT_RULES entry, in the same order
+var ruleLimiters []*rate.Limiter
+
+// waitRuleLimit blocks until the limiter of the first RATE_LIMIT_RULES entry matching the URL admits another
+// request; URLs no rule matches are limited by GLOBAL_RPS alone
+func waitRuleLimit(ctx context.Context, rawURL string) error {
+	if len(ruleLimiters) == 0 {
+		return nil
+	}
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	for i, rule := range config.RateLimitRules {
+		if !rule.matches(u) {
+			continue
+		}
+		startTime := time.Now()
+		err := ruleLimiters[i].Wait(ctx)
+		rateLimitRuleWaits.WithLabelValues(strconv.Itoa(i)).Observe(time.Since(startTime).Seconds())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+)
+
+// sensitiveRequestHeaders lists request headers whose values are hidden from raw request captures
+var sensitiveRequestHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Amz-Security-Token"}
+
+// dumpRequest returns the request as it is serialized on the wire with sensitive header values redacted,
+// including the body when CAPTURE_RAW_REQUEST_BODY is set
+func dumpRequest(req *http.Request) string {
+	dumpReq := req.Clone(req.Context())
+	for _, name := range sensitiveRequestHeaders {
+		if dumpReq.Header.Get(name) != "" {
+			dumpReq.Header.Set(name, "REDACTED")
+		}
+	}
+
+	// The clone shares the body, so dump a fresh copy to leave the original unread
+	withBody := config.CaptureRawRequestBody && req.GetBody != nil
+	if withBody {
+		body, err := req.GetBody()
+		if err != nil {
+			log.Printf("Error copying request body for capture: %v", err)
+			withBody = false
+		} else {
+			dumpReq.Body = body
+		}
+	}
+
+	dump, err := httputil.DumpRequestOut(dumpReq, withBody)
+	if err != nil {
+		log.Printf("Error capturing raw request: %v", err)
+		return ""
+	}
+	return string(dump)
+}
+
+// dumpResponseHead returns the response status line and headers without consuming the body
+func dumpResponseHead(resp *http.Response) string {
+	dump, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		log.Printf("Error capturing raw response: %v", err)
+		return ""
+	}
+	return string(dump)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// redactedHeaders lists response headers whose values are hidden from the recent results endpoint
+var redactedHeaders = []string{"Set-Cookie", "Www-Authenticate", "Proxy-Authenticate"}
+
+// recentBuffer keeps the most recent outputs in a fixed-size ring
+type recentBuffer struct {
+	mu      sync.Mutex
+	entries []*OutputPayload
+	next    int
+	full    bool
+}
+
+// recentOutputs is the shared buffer of recent outputs, or nil when RECENT_BUFFER_SIZE is unset
+var recentOutputs *recentBuffer
+
+// newRecentBuffer returns a buffer holding the last size outputs
+func newRecentBuffer(size int) *recentBuffer {
+	return &recentBuffer{entries: make([]*OutputPayload, size)}
+}
+
+// add stores a redacted copy of the output, overwriting the oldest entry when the buffer is full
+func (b *recentBuffer) add(output *OutputPayload) {
+	if b == nil {
+		return
+	}
+
+	entry := redactOutput(output)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[b.next] = entry
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// snapshot returns the buffered outputs, newest first
+func (b *recentBuffer) snapshot() []*OutputPayload {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	outputs := slices.Clone(b.entries[:b.next])
+	if b.full {
+		outputs = append(slices.Clone(b.entries[b.next:]), outputs...)
+	}
+	slices.Reverse(outputs)
+	return outputs
+}
+
+// redactOutput returns a copy of the output without bodies and with sensitive header values hidden;
+// the body size and hash are kept so the body can still be identified
+func redactOutput(output *OutputPayload) *OutputPayload {
+	redacted := *output
+	redacted.ResponseBody = ""
+	redacted.ResponseJson = ""
+	redacted.ResponseXml = ""
+	// The raw head repeats the header values redacted below, so it is dropped entirely
+	redacted.RawResponseHead = ""
+
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(output.Headers), &headers); err == nil {
+		for _, name := range redactedHeaders {
+			if _, ok := headers[name]; ok {
+				headers[name] = "REDACTED"
+			}
+		}
+		if encoded, err := json.Marshal(headers); err == nil {
+			redacted.Headers = string(encoded)
+		}
+	}
+	return &redacted
+}
+
+// recentHandler returns the most recently collected outputs, newest first
+func recentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(recentOutputs.snapshot()); err != nil {
+		log.Printf("Error encoding recent outputs: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// maxRedirects matches the number of redirects the default http.Client follows
+const maxRedirects = 10
+
+// redirectPolicy enforces the configured redirect rules for a single fetch and records redirects it refused
+type redirectPolicy struct {
+	// blockedTarget is the URL of a redirect that was not followed
+	blockedTarget string
+
+	// downgradeHops lists the one-based positions of redirects that moved from https to http
+	downgradeHops []int
+}
+
+// checkRedirect implements http.Client.CheckRedirect
+func (p *redirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	// Record redirects that downgrade from https to http, whether or not they are followed
+	if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme == "http" {
+		log.Printf("Redirect %d downgrades from %s to %s", len(via), via[len(via)-1].URL, req.URL)
+		p.downgradeHops = append(p.downgradeHops, len(via))
+	}
+
+	// Redirect targets get the same checks as requested URLs, so a redirect cannot reach a port ALLOWED_PORTS excludes
+	if !isValidURL(req.URL.String()) || !isAllowedPort(req.URL.String()) {
+		log.Printf("Not following invalid redirect from %s to %s", via[len(via)-1].URL, req.URL)
+		p.blockedTarget = req.URL.String()
+		return http.ErrUseLastResponse
+	}
+
+	// Stop on redirect statuses that are not selected for following, such as 307 and 308 re-sending a POST
+	if len(config.FollowRedirectCodes) > 0 && !slices.Contains(config.FollowRedirectCodes, req.Response.StatusCode) {
+		log.Printf("Not following %d redirect from %s to %s", req.Response.StatusCode, via[len(via)-1].URL, req.URL)
+		p.blockedTarget = req.URL.String()
+		return http.ErrUseLastResponse
+	}
+
+	// Stop on the redirect response when it leaves the original host
+	if config.SameHostRedirectsOnly && !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		log.Printf("Not following cross-host redirect from %s to %s", via[0].URL, req.URL)
+		p.blockedTarget = req.URL.String()
+		return http.ErrUseLastResponse
+	}
+
+	return resignRedirect(req)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestCheckRedirect(t *testing.T) {
+	tests := []struct {
+		name          string
+		update        func(c *Config)
+		via           []string
+		target        string
+		status        int
+		wantErr       error
+		wantBlocked   bool
+		wantDowngrade []int
+	}{
+		{"followed", nil, []string{"https://example.com/"}, "https://example.com/next", http.StatusFound, nil, false, nil},
+		{"downgrade recorded", nil, []string{"https://example.com/"}, "http://example.com/", http.StatusFound, nil, false, []int{1}},
+		{
+			"port outside ALLOWED_PORTS",
+			func(c *Config) { c.AllowedPorts = []int{80, 443} },
+			[]string{"https://example.com/"}, "http://10.0.0.1:6379/", http.StatusFound,
+			http.ErrUseLastResponse, true, []int{1},
+		},
+		{
+			"default port within ALLOWED_PORTS",
+			func(c *Config) { c.AllowedPorts = []int{443} },
+			[]string{"https://example.com/"}, "https://example.org/", http.StatusFound, nil, false, nil,
+		},
+		{
+			"cross-host with SAME_HOST_REDIRECTS_ONLY",
+			func(c *Config) { c.SameHostRedirectsOnly = true },
+			[]string{"https://example.com/"}, "https://other.example/", http.StatusFound,
+			http.ErrUseLastResponse, true, nil,
+		},
+		{
+			"same host with SAME_HOST_REDIRECTS_ONLY",
+			func(c *Config) { c.SameHostRedirectsOnly = true },
+			[]string{"https://Example.com/"}, "https://example.com/next", http.StatusMovedPermanently, nil, false, nil,
+		},
+		{
+			"status not in FOLLOW_REDIRECT_CODES",
+			func(c *Config) { c.FollowRedirectCodes = []int{301, 302} },
+			[]string{"https://example.com/"}, "https://example.com/next", http.StatusTemporaryRedirect,
+			http.ErrUseLastResponse, true, nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, tt.update)
+
+			var via []*http.Request
+			for _, url := range tt.via {
+				req, err := http.NewRequest(http.MethodGet, url, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				via = append(via, req)
+			}
+			req, err := http.NewRequest(http.MethodGet, tt.target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Response = &http.Response{StatusCode: tt.status}
+
+			var policy redirectPolicy
+			err = policy.checkRedirect(req, via)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkRedirect() error = %v, want %v", err, tt.wantErr)
+			}
+			if blocked := policy.blockedTarget == tt.target; blocked != tt.wantBlocked {
+				t.Errorf("blockedTarget = %q, want blocked %t", policy.blockedTarget, tt.wantBlocked)
+			}
+			if !slices.Equal(policy.downgradeHops, tt.wantDowngrade) {
+				t.Errorf("downgradeHops = %v, want %v", policy.downgradeHops, tt.wantDowngrade)
+			}
+		})
+	}
+}
+
+func TestCheckRedirectLimit(t *testing.T) {
+	setConfig(t, nil)
+	via := make([]*http.Request, maxRedirects)
+	for i := range via {
+		via[i], _ = http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/next", nil)
+
+	var policy redirectPolicy
+	if err := policy.checkRedirect(req, via); err == nil || errors.Is(err, http.ErrUseLastResponse) {
+		t.Errorf("checkRedirect() after %d redirects = %v, want a stop error", maxRedirects, err)
+	}
+}
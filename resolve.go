@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"net"
+	neturl "net/url"
+	"time"
+)
+
+// resolveHost resolves the URL's host without making a request, reporting the addresses and the lookup time
+func resolveHost(ctx context.Context, input InputPayload) (*OutputPayload, error) {
+	parsedURL, err := neturl.Parse(input.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, parsedURL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	output := &OutputPayload{
+		URL:         input.URL,
+		Host:        parsedURL.Host,
+		Outcome:     resultSuccess,
+		DNSTime:     time.Since(startTime).Milliseconds(),
+		RequestTime: startTime.UTC().Format(time.RFC3339Nano),
+	}
+	for _, addr := range addrs {
+		output.ResolvedIPs = append(output.ResolvedIPs, addr.IP.String())
+	}
+	return output, nil
+}
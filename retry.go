@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// fetchWithRetries fetches the URL, retrying failed attempts with exponential backoff until the
+// configured number of retries is exhausted or the context's overall deadline set by collectURL is reached
+func fetchWithRetries(ctx context.Context, input InputPayload) (*OutputPayload, error) {
+	var output *OutputPayload
+	var err error
+	bodyRetried := false
+	for attempt := 0; ; attempt++ {
+		output, err = fetchFollowingMetaRefresh(ctx, input)
+		bodyRetry := err == nil && output.bodyRetry
+		if !(shouldRetry(output, err) || bodyRetry) || attempt >= config.FetchRetries {
+			break
+		}
+		bodyRetried = bodyRetried || bodyRetry
+
+		delay := retryBackoff(attempt)
+		log.Printf("Retrying %s in %s after attempt %d", input.URL, delay, attempt+1)
+		if sleepContext(ctx, delay) != nil {
+			break
+		}
+	}
+
+	if err == nil && bodyRetried {
+		output.BodyRetried = true
+	}
+	if err != nil && config.MaxTotalDuration > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w (overall deadline of %s reached)", err, config.MaxTotalDuration)
+	}
+	return output, err
+}
+
+// shouldRetry reports whether a fetch attempt failed in a way that another attempt may fix; a fetch abandoned
+// on TTFB_BUDGET_MS is not retried, since the budget exists to free the worker right away
+func shouldRetry(output *OutputPayload, err error) bool {
+	if err != nil {
+		return !errors.Is(err, errTTFBBudgetExceeded)
+	}
+	return output.StatusCode >= http.StatusInternalServerError
+}
+
+// Backoff modes controlling how the delay between retries grows
+const (
+	retryBackoffConstant    = "constant"
+	retryBackoffExponential = "exponential"
+)
+
+// Jitter strategies applied to the retry backoff
+const (
+	retryJitterNone  = "none"
+	retryJitterFull  = "full"
+	retryJitterEqual = "equal"
+)
+
+// maxRetryBackoff caps the exponential backoff between attempts
+const maxRetryBackoff = time.Minute
+
+// retryBackoff returns the delay before the retry following the given zero-based attempt
+func retryBackoff(attempt int) time.Duration {
+	if config.RetryBackoffMode == retryBackoffConstant {
+		return applyRetryJitter(config.RetryDelay)
+	}
+
+	delay := config.RetryDelay
+	for range attempt {
+		if delay >= maxRetryBackoff {
+			break
+		}
+		delay *= 2
+	}
+	return applyRetryJitter(min(delay, maxRetryBackoff))
+}
+
+// applyRetryJitter randomizes a backoff delay using the configured jitter strategy
+func applyRetryJitter(delay time.Duration) time.Duration {
+	if delay <= 0 {
+		return delay
+	}
+
+	switch config.RetryJitter {
+	case retryJitterFull:
+		return rand.N(delay + 1)
+	case retryJitterEqual:
+		return delay/2 + rand.N(delay/2+1)
+	default:
+		return delay
+	}
+}
+
+// sleepContext waits for the duration, returning early with the context error if the context ends first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
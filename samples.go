@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"math"
+	"slices"
+)
+
+// maxSamples bounds how many times a single request may ask for its URL to be fetched
+const maxSamples = 100
+
+// SampleStats summarizes the response times in milliseconds of repeated fetches of the same URL
+type SampleStats struct {
+	Count int     `json:"count"`
+	Min   int64   `json:"min"`
+	Max   int64   `json:"max"`
+	Mean  float64 `json:"mean"`
+	P95   int64   `json:"p95"`
+}
+
+// fetchSamples fetches the URL the number of times requested by the payload, returning the last output
+// annotated with statistics over every sample's response time
+func fetchSamples(ctx context.Context, input InputPayload) (*OutputPayload, error) {
+	var output *OutputPayload
+	var times []int64
+	for range max(input.Samples, 1) {
+		var err error
+		output, err = fetchWithRetries(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, output.ResponseTime)
+	}
+
+	if len(times) > 1 {
+		output.Samples = summarizeSamples(times)
+	}
+	return output, nil
+}
+
+// summarizeSamples computes the statistics for a set of response times, using the nearest-rank percentile
+func summarizeSamples(times []int64) *SampleStats {
+	sorted := slices.Clone(times)
+	slices.Sort(sorted)
+
+	var total int64
+	for _, t := range sorted {
+		total += t
+	}
+
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	return &SampleStats{
+		Count: len(sorted),
+		Min:   sorted[0],
+		Max:   sorted[len(sorted)-1],
+		Mean:  float64(total) / float64(len(sorted)),
+		P95:   sorted[rank],
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ServerTiming is one metric reported by the server in a Server-Timing header
+type ServerTiming struct {
+	Name        string   `json:"name"`
+	Duration    *float64 `json:"duration,omitempty"` // in milliseconds
+	Description string   `json:"description,omitempty"`
+}
+
+// parseServerTimings parses every Server-Timing header into its metrics, such as
+// `db;dur=53, cache;desc="Cache Read";dur=23.2`; metrics without a duration keep a nil Duration
+func parseServerTimings(header http.Header) []ServerTiming {
+	var timings []ServerTiming
+	for _, value := range header.Values("Server-Timing") {
+		for _, entry := range splitQuoted(value, ',') {
+			params := splitQuoted(entry, ';')
+			name := strings.TrimSpace(params[0])
+			if name == "" {
+				continue
+			}
+
+			timing := ServerTiming{Name: name}
+			for _, param := range params[1:] {
+				key, paramValue, _ := strings.Cut(param, "=")
+				paramValue = strings.TrimSpace(paramValue)
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "dur":
+					if duration, err := strconv.ParseFloat(strings.Trim(paramValue, `"`), 64); err == nil && timing.Duration == nil {
+						timing.Duration = &duration
+					}
+				case "desc":
+					if timing.Description == "" {
+						timing.Description = unquoteHeaderValue(paramValue)
+					}
+				}
+			}
+			timings = append(timings, timing)
+		}
+	}
+	return timings
+}
+
+// splitQuoted splits a header value on the separator, ignoring separators inside quoted strings
+func splitQuoted(value string, sep rune) []string {
+	var parts []string
+	var current strings.Builder
+	quoted, escaped := false, false
+	for _, r := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == sep && !quoted:
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	return append(parts, current.String())
+}
+
+// unquoteHeaderValue removes the quotes and backslash escapes of a quoted-string, returning tokens unchanged
+func unquoteHeaderValue(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+
+	var unquoted strings.Builder
+	escaped := false
+	for _, r := range value[1 : len(value)-1] {
+		if !escaped && r == '\\' {
+			escaped = true
+			continue
+		}
+		escaped = false
+		unquoted.WriteRune(r)
+	}
+	return unquoted.String()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseServerTimings(t *testing.T) {
+	duration := func(ms float64) *float64 { return &ms }
+	tests := []struct {
+		name    string
+		headers []string
+		want    []ServerTiming
+	}{
+		{"none", nil, nil},
+		{"name only", []string{"miss"}, []ServerTiming{{Name: "miss"}}},
+		{
+			"duration and description",
+			[]string{`db;dur=53, cache;desc="Cache Read";dur=23.2`},
+			[]ServerTiming{{Name: "db", Duration: duration(53)}, {Name: "cache", Duration: duration(23.2), Description: "Cache Read"}},
+		},
+		{
+			"separators inside quotes",
+			[]string{`app;desc="a, b; c";dur=1`},
+			[]ServerTiming{{Name: "app", Duration: duration(1), Description: "a, b; c"}},
+		},
+		{"escaped quote", []string{`app;desc="say \"hi\""`}, []ServerTiming{{Name: "app", Description: `say "hi"`}}},
+		{"token description", []string{"edge;desc=fra"}, []ServerTiming{{Name: "edge", Description: "fra"}}},
+		{"first duration wins", []string{"db;dur=1;dur=2"}, []ServerTiming{{Name: "db", Duration: duration(1)}}},
+		{"invalid duration", []string{"db;dur=fast"}, []ServerTiming{{Name: "db"}}},
+		{"empty entries skipped", []string{" , db;dur=5 ,"}, []ServerTiming{{Name: "db", Duration: duration(5)}}},
+		{
+			"several headers",
+			[]string{"a;dur=1", "b;dur=2"},
+			[]ServerTiming{{Name: "a", Duration: duration(1)}, {Name: "b", Duration: duration(2)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for _, value := range tt.headers {
+				header.Add("Server-Timing", value)
+			}
+			if got := parseServerTimings(header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseServerTimings(%q) = %+v, want %+v", tt.headers, got, tt.want)
+			}
+		})
+	}
+}
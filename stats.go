@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Shape of the sliding window over which /stats reports the error rate
+const (
+	statsBucketWidth = 10 * time.Second
+	statsBucketCount = 30
+)
+
+// statsBucket counts the outputs collected during one slice of the sliding window
+type statsBucket struct {
+	slot     int64
+	total    int64
+	failures int64
+}
+
+// collectorStats keeps in-process counters of collected outputs since startup and over a sliding window
+type collectorStats struct {
+	started           time.Time
+	total             atomic.Int64
+	failures          atomic.Int64
+	outcomes          map[string]*atomic.Int64
+	responseTimeTotal atomic.Int64
+	responseTimeCount atomic.Int64
+
+	mu      sync.Mutex
+	buckets [statsBucketCount]statsBucket
+}
+
+// stats holds the counters reported by GET /stats
+var stats = newCollectorStats()
+
+// newCollectorStats returns empty counters for every outcome
+func newCollectorStats() *collectorStats {
+	s := &collectorStats{started: time.Now(), outcomes: make(map[string]*atomic.Int64)}
+	for _, outcome := range []string{resultSuccess, resultHTTP4xx, resultHTTP5xx, resultTimeout, resultDNSError,
+		resultConnectionError, resultTLSError, resultInvalidInput, resultInternalError} {
+		s.outcomes[outcome] = &atomic.Int64{}
+	}
+	return s
+}
+
+// record counts a collected output; anything other than a successful outcome counts as a failure
+func (s *collectorStats) record(output *OutputPayload) {
+	s.total.Add(1)
+	failed := output.Outcome != resultSuccess
+	if failed {
+		s.failures.Add(1)
+	}
+	if counter, ok := s.outcomes[output.Outcome]; ok {
+		counter.Add(1)
+	}
+	if output.StatusCode != 0 {
+		s.responseTimeTotal.Add(output.ResponseTime)
+		s.responseTimeCount.Add(1)
+	}
+
+	slot := time.Now().UnixNano() / int64(statsBucketWidth)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket := &s.buckets[slot%statsBucketCount]
+	if bucket.slot != slot {
+		*bucket = statsBucket{slot: slot}
+	}
+	bucket.total++
+	if failed {
+		bucket.failures++
+	}
+}
+
+// statsSnapshot is the JSON returned by GET /stats
+type statsSnapshot struct {
+	Since               string           `json:"since"`
+	Total               int64            `json:"total"`
+	Success             int64            `json:"success"`
+	Failure             int64            `json:"failure"`
+	Outcomes            map[string]int64 `json:"outcomes"`
+	AverageResponseTime float64          `json:"averageResponseTime"` // in milliseconds
+	Window              string           `json:"window"`
+	WindowTotal         int64            `json:"windowTotal"`
+	WindowFailure       int64            `json:"windowFailure"`
+	WindowErrorRate     float64          `json:"windowErrorRate"`
+}
+
+// snapshot returns the current counters, counting only window buckets that are still in the window
+func (s *collectorStats) snapshot() statsSnapshot {
+	snapshot := statsSnapshot{
+		Since:    s.started.UTC().Format(time.RFC3339),
+		Total:    s.total.Load(),
+		Failure:  s.failures.Load(),
+		Outcomes: make(map[string]int64, len(s.outcomes)),
+		Window:   (statsBucketWidth * statsBucketCount).String(),
+	}
+	snapshot.Success = snapshot.Total - snapshot.Failure
+	for outcome, counter := range s.outcomes {
+		snapshot.Outcomes[outcome] = counter.Load()
+	}
+	if count := s.responseTimeCount.Load(); count > 0 {
+		snapshot.AverageResponseTime = float64(s.responseTimeTotal.Load()) / float64(count)
+	}
+
+	oldest := time.Now().UnixNano()/int64(statsBucketWidth) - statsBucketCount + 1
+	s.mu.Lock()
+	for _, bucket := range s.buckets {
+		if bucket.slot >= oldest {
+			snapshot.WindowTotal += bucket.total
+			snapshot.WindowFailure += bucket.failures
+		}
+	}
+	s.mu.Unlock()
+	if snapshot.WindowTotal > 0 {
+		snapshot.WindowErrorRate = float64(snapshot.WindowFailure) / float64(snapshot.WindowTotal)
+	}
+	return snapshot
+}
+
+// statsHandler returns a summary of the outputs collected by this instance
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats.snapshot()); err != nil {
+		log.Printf("Error encoding stats: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache remembers the last value observed per URL, evicting the least recently used URL when full
+type lruCache[V any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// lruEntry is the value stored in the lruCache order list
+type lruEntry[V any] struct {
+	url   string
+	value V
+}
+
+// newLRUCache returns a cache holding up to size URLs
+func newLRUCache[V any](size int) *lruCache[V] {
+	return &lruCache[V]{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// lastStatuses is the shared status cache, or nil when status change detection is disabled
+var lastStatuses *lruCache[int]
+
+// swap records the value for the URL and returns the previously recorded one, if any
+func (c *lruCache[V]) swap(url string, value V) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[url]; ok {
+		entry := element.Value.(*lruEntry[V])
+		previous := entry.value
+		entry.value = value
+		c.order.MoveToFront(element)
+		return previous, true
+	}
+
+	c.entries[url] = c.order.PushFront(&lruEntry[V]{url: url, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[V]).url)
+	}
+	var zero V
+	return zero, false
+}
+
+// recordStatusChange flags the output when its status class differs from the last one observed for the URL and
+// method, so each method requested for a URL is tracked separately
+func recordStatusChange(output *OutputPayload, method string) {
+	if lastStatuses == nil || output.StatusCode == 0 {
+		return
+	}
+
+	previous, ok := lastStatuses.swap(method+" "+output.URL, output.StatusCode)
+	if ok && previous/100 != output.StatusCode/100 {
+		output.StatusChanged = true
+		output.PreviousStatusCode = previous
+	}
+}
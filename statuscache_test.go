@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestLRUCacheSwap(t *testing.T) {
+	type swap struct {
+		url          string
+		value        int
+		wantPrevious int
+		wantFound    bool
+	}
+	tests := []struct {
+		name  string
+		size  int
+		swaps []swap
+	}{
+		{
+			"replaces the previous value",
+			2,
+			[]swap{{"a", 200, 0, false}, {"a", 500, 200, true}, {"a", 404, 500, true}},
+		},
+		{
+			"evicts the oldest URL when full",
+			2,
+			[]swap{{"a", 1, 0, false}, {"b", 2, 0, false}, {"c", 3, 0, false}, {"a", 4, 0, false}, {"c", 5, 3, true}},
+		},
+		{
+			"a swap counts as use",
+			2,
+			[]swap{{"a", 1, 0, false}, {"b", 2, 0, false}, {"a", 3, 1, true}, {"c", 4, 0, false}, {"a", 5, 3, true}, {"b", 6, 0, false}},
+		},
+		{
+			"size one keeps only the last URL",
+			1,
+			[]swap{{"a", 1, 0, false}, {"b", 2, 0, false}, {"a", 3, 0, false}, {"a", 4, 3, true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newLRUCache[int](tt.size)
+			for i, s := range tt.swaps {
+				previous, found := cache.swap(s.url, s.value)
+				if previous != s.wantPrevious || found != s.wantFound {
+					t.Fatalf("swap %d (%s=%d) = %d, %t; want %d, %t", i, s.url, s.value, previous, found, s.wantPrevious, s.wantFound)
+				}
+			}
+			if cache.order.Len() > tt.size || len(cache.entries) != cache.order.Len() {
+				t.Errorf("cache holds %d entries and %d list elements, size %d", len(cache.entries), cache.order.Len(), tt.size)
+			}
+		})
+	}
+}
+
+func TestRecordStatusChange(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		status       int
+		wantChanged  bool
+		wantPrevious int
+	}{
+		{"first observation", "GET", 200, false, 0},
+		{"same class", "GET", 204, false, 0},
+		{"class changed", "GET", 503, true, 204},
+		{"other method tracked separately", "HEAD", 404, false, 0},
+		{"back to success", "GET", 200, true, 503},
+	}
+	previous := lastStatuses
+	t.Cleanup(func() { lastStatuses = previous })
+	lastStatuses = newLRUCache[int](10)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &OutputPayload{URL: "https://example.com/", StatusCode: tt.status}
+			recordStatusChange(output, tt.method)
+			if output.StatusChanged != tt.wantChanged || output.PreviousStatusCode != tt.wantPrevious {
+				t.Errorf("StatusChanged = %t, PreviousStatusCode = %d; want %t, %d", output.StatusChanged, output.PreviousStatusCode, tt.wantChanged, tt.wantPrevious)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchTrace records connection details observed through httptrace while a request is made
+type fetchTrace struct {
+	mu         sync.Mutex
+	remoteAddr string
+	firstByte  func()
+	reused     bool
+	idleTime   time.Duration
+	earlyHints []map[string]string
+}
+
+// clientTrace returns the httptrace hooks that populate the trace
+func (t *fetchTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Conn == nil {
+				return
+			}
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.remoteAddr = info.Conn.RemoteAddr().String()
+			t.reused = info.Reused
+			t.idleTime = 0
+			if info.WasIdle {
+				t.idleTime = info.IdleTime
+			}
+		},
+		GotFirstResponseByte: func() {
+			if t.firstByte != nil {
+				t.firstByte()
+			}
+		},
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code != http.StatusEarlyHints {
+				return nil
+			}
+
+			hints := make(map[string]string, len(header))
+			for key, values := range header {
+				hints[key] = strings.Join(values, ", ")
+			}
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.earlyHints = append(t.earlyHints, hints)
+			return nil
+		},
+	}
+}
+
+// RemoteAddr returns the IP:port of the connection that carried the request
+func (t *fetchTrace) RemoteAddr() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remoteAddr
+}
+
+// ConnectionReused reports whether the connection was reused from the pool and how long it sat idle before
+func (t *fetchTrace) ConnectionReused() (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.reused, t.idleTime
+}
+
+// EarlyHints returns the headers of each 103 Early Hints response received before the final response
+func (t *fetchTrace) EarlyHints() []map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.earlyHints
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// transformMaxSteps bounds the work a transform may do on a single body so a faulty script cannot stall a fetch
+const transformMaxSteps = 10_000_000
+
+// transformFunc is the transform function compiled from the configured script, or nil when none is configured
+var transformFunc starlark.Callable
+
+// loadTransform compiles a Starlark script that must define transform(body, data, headers), where body is the
+// raw body string, data is the parsed JSON body or None, and headers is a dict of response headers
+func loadTransform(name string, src string) (starlark.Callable, error) {
+	thread := &starlark.Thread{Name: "load " + name}
+	predeclared := starlark.StringDict{"json": starlarkjson.Module}
+
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, name, src, predeclared)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := globals["transform"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s does not define a transform function", name)
+	}
+	return fn, nil
+}
+
+// transformBody runs the transform against a response body; a string result replaces the body as-is while any
+// other value is encoded as JSON
+func transformBody(body []byte, header http.Header) ([]byte, error) {
+	thread := &starlark.Thread{Name: "transform"}
+	thread.SetMaxExecutionSteps(transformMaxSteps)
+
+	var data starlark.Value = starlark.None
+	if json.Valid(body) {
+		decoded, err := starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(body)}, nil)
+		if err != nil {
+			return nil, err
+		}
+		data = decoded
+	}
+
+	headers := starlark.NewDict(len(header))
+	for key, values := range header {
+		if err := headers.SetKey(starlark.String(key), starlark.String(strings.Join(values, ", "))); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := starlark.Call(thread, transformFunc, starlark.Tuple{starlark.String(body), data, headers}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := result.(type) {
+	case starlark.String:
+		return []byte(string(value)), nil
+	case starlark.Bytes:
+		return []byte(string(value)), nil
+	}
+
+	encoded, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{result}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(string(encoded.(starlark.String))), nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// httpTransport is the shared transport used for every fetch so pooled connections and DNS lookups are reused
+var httpTransport = newTransport()
+
+// newTransport builds the transport used for outbound requests, applying the configured connection-phase
+// timeouts independently of the overall request timeout and the configured pooled connection lifetimes
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.DialTimeout > 0 || config.MaxConnLifetime > 0 || config.SOCKS5Proxy != "" {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		if config.DialTimeout > 0 {
+			dialer.Timeout = config.DialTimeout
+		}
+		transport.DialContext = dialer.DialContext
+		if config.SOCKS5Proxy != "" {
+			// SOCKS5 egress replaces any HTTP proxy from the environment
+			socksDialer, err := socks5Dialer(config.SOCKS5Proxy, dialer)
+			if err != nil {
+				log.Fatalf("Invalid SOCKS5 proxy: %v", err)
+			}
+			transport.DialContext = socksDialer.DialContext
+			transport.Proxy = nil
+		}
+		if config.MaxConnLifetime > 0 {
+			transport.DialContext = lifetimeDialer(transport.DialContext, config.MaxConnLifetime)
+			// HTTP/2 writes control frames while a response streams in, which an expired lifetimeConn would
+			// mistake for a new request, so connections with a lifetime only speak HTTP/1.1
+			transport.ForceAttemptHTTP2 = false
+			transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		}
+	}
+	transport.DialContext = dnsRetryDialer(transport.DialContext)
+	if config.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = config.TLSHandshakeTimeout
+	}
+	transport.TLSClientConfig = &tls.Config{MinVersion: tlsVersions[config.TLSMinVersion]}
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+	transport.DisableKeepAlives = config.DisableKeepAlive
+	transport.ReadBufferSize = config.ReadBufferSize
+	transport.WriteBufferSize = config.WriteBufferSize
+	return transport
+}
+
+// socks5Dialer returns a dialer that connects through the SOCKS5 server at the proxy URL, authenticating with
+// the credentials in the URL if any
+func socks5Dialer(proxyURL string, forward *net.Dialer) (proxy.ContextDialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, fmt.Errorf("missing host or port in %s", u.Redacted())
+	}
+
+	dialer, err := proxy.FromURL(u, forward)
+	if err != nil {
+		return nil, err
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("dialer for %s does not support contexts", u.Redacted())
+	}
+	return contextDialer, nil
+}
+
+// tlsVersions maps the TLS_MIN_VERSION values to their crypto/tls versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// errConnExpired is returned by connections used for a new request after their maximum lifetime
+var errConnExpired = errors.New("connection exceeded its maximum lifetime")
+
+// lifetimeDialer wraps a dial function so every connection it opens expires after the lifetime
+func lifetimeDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error), lifetime time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &lifetimeConn{Conn: conn, expires: time.Now().Add(lifetime)}, nil
+	}
+}
+
+// lifetimeConn closes itself instead of starting a new request once its lifetime has passed; nothing has been
+// written at that point, so the transport retries the request on a fresh connection
+type lifetimeConn struct {
+	net.Conn
+	expires time.Time
+
+	// readSinceWrite is set once a read completes, so the next write is the start of a new request rather than
+	// the continuation of one in flight
+	readSinceWrite atomic.Bool
+}
+
+// Read implements net.Conn
+func (c *lifetimeConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.readSinceWrite.Store(true)
+	return n, err
+}
+
+// Write implements net.Conn
+func (c *lifetimeConn) Write(p []byte) (int, error) {
+	if c.readSinceWrite.Swap(false) && time.Now().After(c.expires) {
+		c.Conn.Close()
+		return 0, errConnExpired
+	}
+	return c.Conn.Write(p)
+}
+
+// transportFor returns the transport for a fetch, cloning the shared one when the payload overrides the TLS
+// server name so the override never applies to pooled connections used by other fetches, or disables keep-alive
+// so the fetch never rides a pooled connection
+func transportFor(input InputPayload) *http.Transport {
+	if input.ServerName == "" && !input.DisableKeepAlive {
+		return httpTransport
+	}
+
+	transport := httpTransport.Clone()
+	if input.ServerName != "" {
+		transport.TLSClientConfig.ServerName = input.ServerName
+	}
+	transport.DisableKeepAlives = transport.DisableKeepAlives || input.DisableKeepAlive
+	return transport
+}
+
+// warmUpHosts issues HEAD requests to each host in parallel so DNS is resolved and pooled connections are
+// open before the first fetch; failures are logged but otherwise ignored
+func warmUpHosts(hosts []string) {
+	client := &http.Client{
+		Transport: httpTransport,
+		Timeout:   5 * time.Second,
+	}
+
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		target := host
+		if !strings.Contains(target, "://") {
+			target = "https://" + target
+		}
+
+		wg.Go(func() {
+			req, err := http.NewRequest(http.MethodHead, target, nil)
+			if err != nil {
+				log.Printf("Warm-up of %s failed: %v", target, err)
+				return
+			}
+			req.Header.Set("User-Agent", userAgent())
+
+			startTime := time.Now()
+			resp, err := client.Do(req)
+			if err != nil {
+				log.Printf("Warm-up of %s failed: %v", target, err)
+				return
+			}
+			resp.Body.Close()
+			log.Printf("Warmed up %s in %s", target, time.Since(startTime))
+		})
+	}
+	wg.Wait()
+}
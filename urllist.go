@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// maxURLListBytes bounds how much of a URL list object is read
+const maxURLListBytes = 10 * 1024 * 1024
+
+// errInvalidURLListURI reports a urlsGcs value that is not a gs://bucket/object URI
+var errInvalidURLListURI = errors.New("invalid GCS URI, expected gs://bucket/object")
+
+// urlListError reports a URL list that could not be read from GCS
+type urlListError struct {
+	uri string
+	err error
+}
+
+func (e *urlListError) Error() string {
+	return fmt.Sprintf("reading URL list %s: %v", e.uri, e.err)
+}
+
+func (e *urlListError) Unwrap() error {
+	return e.err
+}
+
+// outcome returns the handler outcome of the failed read: a malformed URI or an object that is missing or not
+// readable will fail the same way when redelivered, while other errors may be temporary
+func (e *urlListError) outcome() handlerOutcome {
+	var apiErr *googleapi.Error
+	if errors.Is(e.err, errInvalidURLListURI) {
+		return outcomeInvalidInput
+	}
+	if errors.As(e.err, &apiErr) && (apiErr.Code == http.StatusNotFound || apiErr.Code == http.StatusForbidden) {
+		return outcomeInvalidInput
+	}
+	return outcomeTransientError
+}
+
+// loadURLList appends the URLs listed in the payload's GCS object, one per line, to its URLs
+func (p *InputPayload) loadURLList(ctx context.Context) error {
+	if p.URLsGCS == "" {
+		return nil
+	}
+
+	urls, err := readURLList(ctx, p.URLsGCS)
+	if err != nil {
+		return &urlListError{uri: p.URLsGCS, err: err}
+	}
+	p.URLs = append(p.URLs, urls...)
+	p.URLsGCS = ""
+	p.listedURLs = len(urls)
+	return nil
+}
+
+// batchSizeError returns why the requests are too many to collect from one message, or "" when they are not;
+// requests from inline lists count toward MAX_BATCH_SIZE and those loaded from urlsGcs toward MAX_URL_LIST_SIZE
+func batchSizeError(requests []InputPayload) string {
+	listed := 0
+	for _, request := range requests {
+		if request.fromURLList {
+			listed++
+		}
+	}
+	if inline := len(requests) - listed; config.MaxBatchSize > 0 && inline > config.MaxBatchSize {
+		return fmt.Sprintf("Batch of %d URLs exceeds MAX_BATCH_SIZE of %d", inline, config.MaxBatchSize)
+	}
+	if config.MaxURLListSize > 0 && listed > config.MaxURLListSize {
+		return fmt.Sprintf("URL list of %d URLs exceeds MAX_URL_LIST_SIZE of %d", listed, config.MaxURLListSize)
+	}
+	return ""
+}
+
+// needsFanOut reports whether the requests include URLs loaded from urlsGcs and are more than one message may
+// collect, so they must be split into messages of at most MAX_BATCH_SIZE requests instead
+func needsFanOut(requests []InputPayload) bool {
+	if config.MaxBatchSize == 0 || len(requests) <= config.MaxBatchSize {
+		return false
+	}
+	return slices.ContainsFunc(requests, func(request InputPayload) bool { return request.fromURLList })
+}
+
+// readURLList downloads a newline-delimited list of URLs from a gs:// URI, skipping blank lines
+func readURLList(ctx context.Context, uri string) ([]string, error) {
+	bucket, object, ok := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+	if !strings.HasPrefix(uri, "gs://") || !ok || bucket == "" || object == "" {
+		return nil, errInvalidURLListURI
+	}
+
+	client, err := storageService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Objects.Get(bucket, object).Context(ctx).Download()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxURLListBytes))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			urls = append(urls, line)
+		}
+	}
+	return urls, scanner.Err()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// listedRequests returns inline requests followed by requests loaded from a URL list
+func listedRequests(inline, listed int) []InputPayload {
+	payload := InputPayload{listedURLs: listed}
+	for i := range inline + listed {
+		payload.URLs = append(payload.URLs, fmt.Sprintf("https://example.com/%d", i))
+	}
+	return payload.expand()
+}
+
+func TestBatchSizeError(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBatch int
+		maxList  int
+		inline   int
+		listed   int
+		want     string
+	}{
+		{"within both limits", 2, 3, 2, 3, ""},
+		{"inline over MAX_BATCH_SIZE", 2, 3, 3, 0, "Batch of 3 URLs exceeds MAX_BATCH_SIZE of 2"},
+		{"listed count only toward MAX_URL_LIST_SIZE", 2, 3, 1, 3, ""},
+		{"listed over MAX_URL_LIST_SIZE", 2, 3, 0, 4, "URL list of 4 URLs exceeds MAX_URL_LIST_SIZE of 3"},
+		{"zero limits are unlimited", 0, 0, 500, 500, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, func(c *Config) {
+				c.MaxBatchSize = tt.maxBatch
+				c.MaxURLListSize = tt.maxList
+			})
+			if got := batchSizeError(listedRequests(tt.inline, tt.listed)); got != tt.want {
+				t.Errorf("batchSizeError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsFanOut(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBatch int
+		inline   int
+		listed   int
+		want     bool
+	}{
+		{"list within MAX_BATCH_SIZE", 3, 1, 2, false},
+		{"list over MAX_BATCH_SIZE", 3, 1, 3, true},
+		{"inline only", 3, 4, 0, false},
+		{"unlimited batch size", 0, 0, 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, func(c *Config) { c.MaxBatchSize = tt.maxBatch })
+			if got := needsFanOut(listedRequests(tt.inline, tt.listed)); got != tt.want {
+				t.Errorf("needsFanOut() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
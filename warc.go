@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// encodeWARC serializes an output as a WARC/1.1 record: a response record holding the HTTP status line, headers
+// and body when a response was received, otherwise a metadata record holding the JSON output
+func encodeWARC(output *OutputPayload, data []byte) []byte {
+	recordType, contentType, block := "metadata", "application/json", data
+	if output.StatusCode != 0 {
+		recordType, contentType, block = "response", "application/http;msgtype=response", warcHTTPBlock(output)
+	}
+
+	var record bytes.Buffer
+	record.WriteString("WARC/1.1\r\n")
+	fmt.Fprintf(&record, "WARC-Type: %s\r\n", recordType)
+	fmt.Fprintf(&record, "WARC-Record-ID: <urn:uuid:%s>\r\n", uuid.NewString())
+	fmt.Fprintf(&record, "WARC-Date: %s\r\n", warcDate(output.RequestTime))
+	fmt.Fprintf(&record, "WARC-Target-URI: %s\r\n", cmp.Or(output.EffectiveURL, output.URL))
+	if host, _, err := net.SplitHostPort(output.RemoteAddr); err == nil {
+		fmt.Fprintf(&record, "WARC-IP-Address: %s\r\n", host)
+	}
+	if recordType == "response" && (output.Truncated || output.BodyRef != "" || output.BodySkipped) {
+		// The body in the record is incomplete, or absent when it was skipped or stored in GCS
+		record.WriteString("WARC-Truncated: length\r\n")
+	}
+	fmt.Fprintf(&record, "Content-Type: %s\r\n", contentType)
+	fmt.Fprintf(&record, "Content-Length: %d\r\n\r\n", len(block))
+	record.Write(block)
+	record.WriteString("\r\n\r\n")
+	return record.Bytes()
+}
+
+// warcHTTPBlock rebuilds the HTTP response message from an output with the body as received, before decoding and
+// any transform; the transport has already removed chunked framing, so the framing headers are rewritten to match
+func warcHTTPBlock(output *OutputPayload) []byte {
+	body := output.wireBody
+
+	var headers map[string]string
+	if output.Headers != "" {
+		if err := json.Unmarshal([]byte(output.Headers), &headers); err != nil {
+			headers = nil
+		}
+	}
+
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "HTTP/1.1 %d %s\r\n", output.StatusCode, http.StatusText(output.StatusCode))
+	for _, key := range slices.Sorted(maps.Keys(headers)) {
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Length", "Transfer-Encoding":
+			continue
+		}
+		fmt.Fprintf(&block, "%s: %s\r\n", key, headers[key])
+	}
+	block.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n")
+	block.Write(body)
+	return block.Bytes()
+}
+
+// warcDate formats the request time as a WARC-Date, falling back to the current time
+func warcDate(requestTime string) string {
+	t, err := time.Parse(time.RFC3339Nano, requestTime)
+	if err != nil {
+		t = time.Now()
+	}
+	return t.UTC().Format(time.RFC3339)
+}
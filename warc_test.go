@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// warcRecord splits an encoded WARC record into its header fields and block
+func warcRecord(t *testing.T, record []byte) (map[string]string, string) {
+	t.Helper()
+	head, rest, ok := strings.Cut(string(record), "\r\n\r\n")
+	if !ok || !strings.HasSuffix(rest, "\r\n\r\n") {
+		t.Fatalf("malformed record %q", record)
+	}
+
+	lines := strings.Split(head, "\r\n")
+	if lines[0] != "WARC/1.1" {
+		t.Fatalf("version line = %q", lines[0])
+	}
+	fields := make(map[string]string)
+	for _, line := range lines[1:] {
+		name, value, _ := strings.Cut(line, ": ")
+		fields[name] = value
+	}
+	return fields, strings.TrimSuffix(rest, "\r\n\r\n")
+}
+
+func TestEncodeWARC(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        *OutputPayload
+		data          string
+		wantType      string
+		wantTarget    string
+		wantIP        string
+		wantTruncated bool
+		wantBlock     []string
+		omitBlock     []string
+	}{
+		{
+			name:       "failed fetch",
+			output:     &OutputPayload{URL: "https://example.com/", Error: "Error fetching URL"},
+			data:       `{"url":"https://example.com/"}`,
+			wantType:   "metadata",
+			wantTarget: "https://example.com/",
+			wantBlock:  []string{`{"url":"https://example.com/"}`},
+		},
+		{
+			name: "response with body as received",
+			output: &OutputPayload{
+				URL:          "https://example.com/",
+				EffectiveURL: "https://www.example.com/",
+				RemoteAddr:   "192.0.2.1:443",
+				StatusCode:   200,
+				Headers:      `{"Content-Encoding":"gzip","Content-Length":"999","Content-Type":"text/plain"}`,
+				BodyDecoded:  true,
+				ResponseBody: "decoded",
+				wireBody:     []byte("\x1f\x8bcompressed"),
+			},
+			wantType:   "response",
+			wantTarget: "https://www.example.com/",
+			wantIP:     "192.0.2.1",
+			wantBlock: []string{
+				"HTTP/1.1 200 OK\r\n",
+				"Content-Encoding: gzip\r\n",
+				"Content-Type: text/plain\r\n",
+				"Content-Length: 12\r\n\r\n\x1f\x8bcompressed",
+			},
+			omitBlock: []string{"Content-Length: 999", "decoded"},
+		},
+		{
+			name:          "body stored in GCS",
+			output:        &OutputPayload{URL: "https://example.com/", StatusCode: 200, BodyRef: "gs://bucket/object"},
+			wantType:      "response",
+			wantTarget:    "https://example.com/",
+			wantTruncated: true,
+			wantBlock:     []string{"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+		},
+		{
+			name:          "truncated body",
+			output:        &OutputPayload{URL: "https://example.com/", StatusCode: 404, Truncated: true, wireBody: []byte("part")},
+			wantType:      "response",
+			wantTarget:    "https://example.com/",
+			wantTruncated: true,
+			wantBlock:     []string{"HTTP/1.1 404 Not Found\r\n", "\r\n\r\npart"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, block := warcRecord(t, encodeWARC(tt.output, []byte(tt.data)))
+
+			if fields["WARC-Type"] != tt.wantType {
+				t.Errorf("WARC-Type = %q, want %q", fields["WARC-Type"], tt.wantType)
+			}
+			if fields["WARC-Target-URI"] != tt.wantTarget {
+				t.Errorf("WARC-Target-URI = %q, want %q", fields["WARC-Target-URI"], tt.wantTarget)
+			}
+			if fields["WARC-IP-Address"] != tt.wantIP {
+				t.Errorf("WARC-IP-Address = %q, want %q", fields["WARC-IP-Address"], tt.wantIP)
+			}
+			if truncated := fields["WARC-Truncated"] == "length"; truncated != tt.wantTruncated {
+				t.Errorf("WARC-Truncated = %q, want truncated %t", fields["WARC-Truncated"], tt.wantTruncated)
+			}
+			if fields["Content-Length"] != strconv.Itoa(len(block)) {
+				t.Errorf("Content-Length = %s, block is %d bytes", fields["Content-Length"], len(block))
+			}
+			if !strings.HasPrefix(fields["WARC-Record-ID"], "<urn:uuid:") {
+				t.Errorf("WARC-Record-ID = %q", fields["WARC-Record-ID"])
+			}
+			for _, want := range tt.wantBlock {
+				if !strings.Contains(block, want) {
+					t.Errorf("block %q does not contain %q", block, want)
+				}
+			}
+			for _, omit := range tt.omitBlock {
+				if strings.Contains(block, omit) {
+					t.Errorf("block %q contains %q", block, omit)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+)
+
+// setWebSocketUpgrade adds the headers of a WebSocket opening handshake (RFC 6455) to a GET request; a
+// subprotocol can be offered with a Sec-WebSocket-Protocol header in the payload
+func setWebSocketUpgrade(header http.Header) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	header.Set("Connection", "Upgrade")
+	header.Set("Upgrade", "websocket")
+	header.Set("Sec-WebSocket-Version", "13")
+	header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+}